@@ -9,3 +9,133 @@ const debug = false
 func (a *Adapter) SetConnectHandler(c func(device Address, connected bool)) {
 	a.connectHandler = c
 }
+
+// ScanParams configures how scanning is done, see SetScanParams.
+type ScanParams struct {
+	// Interval is the time between the start of two scan windows, and Window
+	// is the time the radio listens during each scan window. A window equal
+	// to the interval means continuous scanning, a shorter window saves
+	// power at the cost of missing some advertisements. Create them using
+	// NewDuration. When zero, a default is used.
+	//
+	// They are only supported on Nordic SoftDevices and ignored elsewhere.
+	Interval Duration
+	Window   Duration
+
+	// Mode selects between passive and active scanning. Active scanning sends
+	// a scan request to every advertiser to get its scan response as well,
+	// which often contains the device name, at the cost of more radio
+	// traffic.
+	//
+	// It is supported on Nordic SoftDevices and Windows, and ignored
+	// elsewhere: BlueZ and CoreBluetooth always scan actively.
+	Mode ScanMode
+}
+
+// ScanMode is the scanning mode used in ScanParams.
+type ScanMode uint8
+
+// Scanning modes.
+const (
+	// ScanModeDefault uses the default of the platform: passive on Nordic
+	// SoftDevices, active elsewhere.
+	ScanModeDefault ScanMode = iota
+	ScanModePassive
+	ScanModeActive
+)
+
+// SetScanParams sets the parameters used by the next call to Scan.
+func (a *Adapter) SetScanParams(params ScanParams) {
+	a.scanParams = params
+}
+
+// AdapterState is a snapshot of the current state of the adapter.
+type AdapterState struct {
+	// Scanning is true while a scan is in progress.
+	Scanning bool
+
+	// Advertising is true while an advertisement has been started (and not
+	// stopped). Note that some stacks temporarily stop advertising while
+	// connected, which is not reflected here.
+	Advertising bool
+
+	// Connections is the number of currently active connections, if the
+	// stack reports them.
+	Connections int
+}
+
+// State returns a snapshot of the current state of the adapter.
+func (a *Adapter) State() AdapterState {
+	mask := a.stateLock.lock()
+	state := a.state
+	a.stateLock.unlock(mask)
+	return state
+}
+
+// SetStateChangeHandler sets a handler function to be called whenever the
+// state of the adapter changes, for example when a scan is started or a
+// device connects.
+//
+// The handler is called from whatever context caused the change: on Nordic
+// SoftDevices this is often an interrupt, and on other platforms it may be
+// an internal goroutine. It must therefore be short and must not block. To
+// do slow work, such as updating a display, signal a goroutine from the
+// handler (for example with a buffered channel and a non-blocking send) and
+// do the work there.
+func (a *Adapter) SetStateChangeHandler(c func(state AdapterState)) {
+	mask := a.stateLock.lock()
+	a.stateChangeHandler = c
+	a.stateLock.unlock(mask)
+}
+
+// setScanning updates the Scanning field of the adapter state. When a scan is
+// started, the scanStarted channel is closed (if set).
+func (a *Adapter) setScanning(scanning bool) {
+	mask := a.stateLock.lock()
+	oldState := a.state
+	a.state.Scanning = scanning
+	var started chan struct{}
+	if scanning {
+		started = a.scanStarted
+		a.scanStarted = nil
+	}
+	a.stateChanged(oldState, mask)
+	if started != nil {
+		close(started)
+	}
+}
+
+// setAdvertising updates the Advertising field of the adapter state.
+func (a *Adapter) setAdvertising(advertising bool) {
+	mask := a.stateLock.lock()
+	oldState := a.state
+	a.state.Advertising = advertising
+	a.stateChanged(oldState, mask)
+}
+
+// addConnections adds delta (which may be negative) to the number of active
+// connections in the adapter state.
+func (a *Adapter) addConnections(delta int) {
+	mask := a.stateLock.lock()
+	oldState := a.state
+	a.state.Connections += delta
+	if a.state.Connections < 0 {
+		// Some stacks report disconnects for failed connection attempts.
+		a.state.Connections = 0
+	}
+	a.stateChanged(oldState, mask)
+}
+
+// stateChanged releases the state lock, and then calls the state change
+// handler if the state is different from oldState. The handler is called
+// outside the lock, so that it may call State. No closures are used here,
+// because these functions run in an interrupt on the SoftDevice, where heap
+// allocations are not allowed.
+func (a *Adapter) stateChanged(oldState AdapterState, mask uintptr) {
+	state := a.state
+	handler := a.stateChangeHandler
+	a.stateLock.unlock(mask)
+	if state != oldState && handler != nil {
+		handler(state)
+	}
+}
@@ -24,7 +24,12 @@ type Adapter struct {
 	// used to allow multiple callers to call Connect concurrently.
 	connectMap sync.Map
 
-	connectHandler func(device Address, connected bool)
+	connectHandler     func(device Address, connected bool)
+	stateChangeHandler func(state AdapterState)
+	state              AdapterState
+	stateLock          stateLock
+	scanStarted        chan struct{} // closed when the next scan has started
+	scanParams         ScanParams
 }
 
 // DefaultAdapter is the default adapter on the system.
@@ -112,6 +117,10 @@ func (cmd *centralManagerDelegate) DidDisconnectPeripheral(cmgr cbgo.CentralMana
 	// this will only be true if the receiving side is still waiting for a connection to complete
 	if ch, ok := cmd.a.connectMap.LoadAndDelete(id); ok {
 		ch.(chan cbgo.Peripheral) <- prph
+	} else {
+		// This was an established connection, not a failed connection
+		// attempt.
+		cmd.a.addConnections(-1)
 	}
 }
 
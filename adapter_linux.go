@@ -17,8 +17,15 @@ type Adapter struct {
 	id                   string
 	cancelChan           chan struct{}
 	defaultAdvertisement *Advertisement
+	services             []*Service // added with AddService
+	deviceName           string     // set by SetDeviceName
 
-	connectHandler func(device Address, connected bool)
+	connectHandler     func(device Address, connected bool)
+	stateChangeHandler func(state AdapterState)
+	state              AdapterState
+	stateLock          stateLock
+	scanStarted        chan struct{} // closed when the next scan has started
+	scanParams         ScanParams
 }
 
 // DefaultAdapter is the default adapter on the system. On Linux, it is the
@@ -54,3 +61,22 @@ func (a *Adapter) Address() (MACAddress, error) {
 	}
 	return MACAddress{MAC: mac}, nil
 }
+
+// SetDeviceName sets the name of this device, as shown to other devices. On
+// Linux, this changes the alias of the adapter in BlueZ. Pass an empty string
+// to revert to the system name.
+//
+// The name is also advertised by advertisements that are configured
+// afterwards without an AdvertisementOptions.LocalName. BlueZ shortens it if
+// it doesn't fit. SetDeviceName is not available on Windows and macOS, where
+// the operating system manages the device name.
+func (a *Adapter) SetDeviceName(name string) error {
+	if a.adapter == nil {
+		return errors.New("adapter not enabled")
+	}
+	if err := a.adapter.SetAlias(name); err != nil {
+		return err
+	}
+	a.deviceName = name
+	return nil
+}
@@ -44,6 +44,7 @@ func handleEvent() {
 		case C.BLE_GAP_EVT_CONNECTED:
 			currentConnection.Reg = gapEvent.conn_handle
 			DefaultAdapter.connectHandler(Address{}, true)
+			DefaultAdapter.addConnections(1)
 		case C.BLE_GAP_EVT_DISCONNECTED:
 			if defaultAdvertisement.isAdvertising.Get() != 0 {
 				// The advertisement was running but was automatically stopped
@@ -56,6 +57,11 @@ func handleEvent() {
 			}
 			currentConnection.Reg = C.BLE_CONN_HANDLE_INVALID
 			DefaultAdapter.connectHandler(Address{}, false)
+			DefaultAdapter.addConnections(-1)
+			if DefaultAdapter.disconnectHandler != nil {
+				disconnected := gapEvent.params.unionfield_disconnected()
+				DefaultAdapter.disconnectHandler(Connection(gapEvent.conn_handle), DisconnectReason(disconnected.reason))
+			}
 		case C.BLE_GAP_EVT_CONN_PARAM_UPDATE_REQUEST:
 			// Respond with the default PPCP connection parameters by passing
 			// nil:
@@ -72,6 +78,7 @@ func handleEvent() {
 		}
 	case id >= C.BLE_GATTS_EVT_BASE && id <= C.BLE_GATTS_EVT_LAST:
 		gattsEvent := eventBuf.evt.unionfield_gatts_evt()
+		gattsActivity.Set(gattsActivity.Get() + 1)
 		switch id {
 		case C.BLE_GATTS_EVT_WRITE:
 			writeEvent := gattsEvent.params.unionfield_write()
@@ -109,5 +116,41 @@ func (a *Adapter) Address() (MACAddress, error) {
 	if errCode != 0 {
 		return MACAddress{}, Error(errCode)
 	}
-	return MACAddress{MAC: addr.addr}, nil
+	return MACAddress{MAC: addr.addr, isRandom: addr.addr_type != C.BLE_GAP_ADDR_TYPE_PUBLIC}, nil
+}
+
+// SetRandomAddress sets the address of this device to the given static random
+// address. The two most significant bits of the address must be set, as
+// required for static random addresses.
+//
+// By default, the SoftDevice uses a static random address that is programmed
+// into the chip at the factory.
+func (a *Adapter) SetRandomAddress(mac MAC) error {
+	if mac[5]>>6 != 0b11 {
+		return errNotStaticRandomAddress
+	}
+	var addr C.ble_gap_addr_t
+	addr.addr = mac
+	addr.addr_type = C.BLE_GAP_ADDR_TYPE_RANDOM_STATIC
+	errCode := C.sd_ble_gap_address_set(C.BLE_GAP_ADDR_CYCLE_MODE_NONE, &addr)
+	return makeError(errCode)
+}
+
+// SetTxPower sets the radio transmit power in dBm, for advertising, scanning
+// and connections. A lower transmit power reduces the range, but also the
+// power consumption. Supported values are -40, -30, -20, -16, -12, -8, -4, 0
+// and 4.
+func (a *Adapter) SetTxPower(dBm int8) error {
+	errCode := C.sd_ble_gap_tx_power_set(dBm)
+	if errCode != 0 {
+		return Error(errCode)
+	}
+	a.txPower = dBm
+	return nil
+}
+
+// MaxConnections returns the maximum number of concurrent connections. The
+// S110 SoftDevice only supports a single connection, in the peripheral role.
+func (a *Adapter) MaxConnections() int {
+	return 1
 }
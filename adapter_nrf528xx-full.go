@@ -32,6 +32,7 @@ func handleEvent() {
 				}
 				currentConnection.Reg = gapEvent.conn_handle
 				DefaultAdapter.connectHandler(Address{}, true)
+				DefaultAdapter.addConnections(1)
 			case C.BLE_GAP_ROLE_CENTRAL:
 				if debug {
 					println("evt: connected in central role")
@@ -39,6 +40,7 @@ func handleEvent() {
 				connectionAttempt.connectionHandle = gapEvent.conn_handle
 				connectionAttempt.state.Set(2) // connection was successful
 				DefaultAdapter.connectHandler(Address{}, true)
+				DefaultAdapter.addConnections(1)
 			}
 		case C.BLE_GAP_EVT_DISCONNECTED:
 			if debug {
@@ -51,6 +53,10 @@ func handleEvent() {
 				}
 			}
 			currentConnection.Reg = C.BLE_CONN_HANDLE_INVALID
+			if int(gapEvent.conn_handle) < len(disconnectCounts) {
+				count := &disconnectCounts[gapEvent.conn_handle]
+				count.Set(count.Get() + 1)
+			}
 			// Auto-restart advertisement if needed.
 			if defaultAdvertisement.isAdvertising.Get() != 0 {
 				// The advertisement was running but was automatically stopped
@@ -59,9 +65,14 @@ func handleEvent() {
 				// because it would need to be reconfigured as a non-connectable
 				// advertisement. That's left as a future addition, if
 				// necessary.
-				C.sd_ble_gap_adv_start(defaultAdvertisement.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+				defaultAdvertisement.start()
 			}
 			DefaultAdapter.connectHandler(Address{}, false)
+			DefaultAdapter.addConnections(-1)
+			if DefaultAdapter.disconnectHandler != nil {
+				disconnected := gapEvent.params.unionfield_disconnected()
+				DefaultAdapter.disconnectHandler(Connection(gapEvent.conn_handle), DisconnectReason(disconnected.reason))
+			}
 		case C.BLE_GAP_EVT_ADV_REPORT:
 			advReport := gapEvent.params.unionfield_adv_report()
 			if debug && &scanReportBuffer.data[0] != advReport.data.p_data {
@@ -76,31 +87,99 @@ func handleEvent() {
 				MACAddress{MAC: advReport.peer_addr.addr,
 					isRandom: advReport.peer_addr.bitfield_addr_type() != 0},
 			}
+			globalScanResult.PDUType = 0
+			if advReport._type.bitfield_connectable() != 0 {
+				globalScanResult.PDUType |= AdvertisementConnectable
+			}
+			if advReport._type.bitfield_scannable() != 0 {
+				globalScanResult.PDUType |= AdvertisementScannable
+			}
+			if advReport._type.bitfield_directed() != 0 {
+				globalScanResult.PDUType |= AdvertisementDirected
+			}
+			if advReport._type.bitfield_scan_response() != 0 {
+				globalScanResult.PDUType |= AdvertisementScanResponse
+			}
 			globalScanResult.AdvertisementPayload = &scanReportBuffer
 			// Signal to the main thread that there was a scan report.
 			// Scanning will be resumed (from the main thread) once the scan
 			// report has been processed.
 			gotScanReport.Set(1)
+		case C.BLE_GAP_EVT_ADV_SET_TERMINATED:
+			advSetTerminated := gapEvent.params.unionfield_adv_set_terminated()
+			if debug {
+				println("evt: advertising set terminated:", advSetTerminated.reason)
+			}
+			if advSetTerminated.reason == C.BLE_GAP_EVT_ADV_SET_TERMINATED_REASON_TIMEOUT && defaultAdvertisement.isFast.Get() != 0 {
+				// The fast advertising phase ended, continue advertising at
+				// the slow interval.
+				if defaultAdvertisement.startSlow() == 0 {
+					break
+				}
+			}
+			// Advertising was stopped because of a timeout or event limit.
+			// Make sure it isn't restarted on disconnect.
+			defaultAdvertisement.isAdvertising.Set(0)
+			DefaultAdapter.setAdvertising(false)
+			if defaultAdvertisement.terminatedHandler != nil {
+				defaultAdvertisement.terminatedHandler(AdvertisementTerminateReason(advSetTerminated.reason))
+			}
+		case C.BLE_GAP_EVT_SCAN_REQ_REPORT:
+			scanReqReport := gapEvent.params.unionfield_scan_req_report()
+			if debug {
+				println("evt: scan request report")
+			}
+			if defaultAdvertisement.scanRequestHandler != nil {
+				scanner := Address{
+					MACAddress{MAC: scanReqReport.peer_addr.addr,
+						isRandom: scanReqReport.peer_addr.bitfield_addr_type() != 0},
+				}
+				defaultAdvertisement.scanRequestHandler(scanner, int16(scanReqReport.rssi))
+			}
+		case C.BLE_GAP_EVT_TIMEOUT:
+			timeoutEvent := gapEvent.params.unionfield_timeout()
+			if debug {
+				println("evt: timeout", timeoutEvent.src)
+			}
+			if timeoutEvent.src == C.BLE_GAP_TIMEOUT_SRC_CONN && connectionAttempt.state.Get() == 1 {
+				connectionAttempt.state.Set(3) // connection attempt timed out
+			}
 		case C.BLE_GAP_EVT_CONN_PARAM_UPDATE_REQUEST:
-			// Respond with the default PPCP connection parameters by passing
-			// nil:
-			// > If NULL is provided on a peripheral role, the parameters in the
-			// > PPCP characteristic of the GAP service will be used instead. If
-			// > NULL is provided on a central role and in response to a
-			// > BLE_GAP_EVT_CONN_PARAM_UPDATE_REQUEST, the peripheral request
-			// > will be rejected
-			C.sd_ble_gap_conn_param_update(gapEvent.conn_handle, nil)
+			// The peripheral asked for different connection parameters (this
+			// event is only sent in the central role). Accept them: passing
+			// nil would reject the request.
+			connParamUpdateRequest := gapEvent.params.unionfield_conn_param_update_request()
+			C.sd_ble_gap_conn_param_update(gapEvent.conn_handle, &connParamUpdateRequest.conn_params)
+		case C.BLE_GAP_EVT_CONN_PARAM_UPDATE:
+			// The connection parameters were changed, either by
+			// Device.RequestConnectionParams or by the remote device.
+			if debug {
+				connParamUpdate := gapEvent.params.unionfield_conn_param_update()
+				println("evt: connection parameter update", connParamUpdate.conn_params.max_conn_interval, connParamUpdate.conn_params.slave_latency, connParamUpdate.conn_params.conn_sup_timeout)
+			}
 		case C.BLE_GAP_EVT_DATA_LENGTH_UPDATE_REQUEST:
 			// We need to respond with sd_ble_gap_data_length_update. Setting
 			// both parameters to nil will make sure we send the default values.
 			C.sd_ble_gap_data_length_update(gapEvent.conn_handle, nil, nil)
 		case C.BLE_GAP_EVT_DATA_LENGTH_UPDATE:
-			// ignore confirmation of data length successfully updated
+			// The data length was changed, either by Device.RequestDataLength
+			// or by the remote device. Nothing to do, the SoftDevice splits
+			// data into packets by itself.
+			if debug {
+				dataLengthUpdate := gapEvent.params.unionfield_data_length_update()
+				println("evt: data length update", dataLengthUpdate.effective_params.max_tx_octets, dataLengthUpdate.effective_params.max_rx_octets)
+			}
 		case C.BLE_GAP_EVT_PHY_UPDATE_REQUEST:
 			phyUpdateRequest := gapEvent.params.unionfield_phy_update_request()
 			C.sd_ble_gap_phy_update(gapEvent.conn_handle, &phyUpdateRequest.peer_preferred_phys)
 		case C.BLE_GAP_EVT_PHY_UPDATE:
-			// ignore confirmation of phy successfully updated
+			phyUpdate := gapEvent.params.unionfield_phy_update()
+			if debug {
+				println("evt: phy update", phyUpdate.status, phyUpdate.tx_phy, phyUpdate.rx_phy)
+			}
+			if phyUpdate.status == C.BLE_HCI_STATUS_CODE_SUCCESS && DefaultAdapter.phyUpdateHandler != nil {
+				DefaultAdapter.phyUpdateHandler(Connection(gapEvent.conn_handle), PHY(phyUpdate.tx_phy), PHY(phyUpdate.rx_phy))
+			}
 		default:
 			if debug {
 				println("unknown GAP event:", id)
@@ -108,6 +187,7 @@ func handleEvent() {
 		}
 	case id >= C.BLE_GATTS_EVT_BASE && id <= C.BLE_GATTS_EVT_LAST:
 		gattsEvent := eventBuf.evt.unionfield_gatts_evt()
+		gattsActivity.Set(gattsActivity.Get() + 1)
 		switch id {
 		case C.BLE_GATTS_EVT_WRITE:
 			writeEvent := gattsEvent.params.unionfield_write()
@@ -209,10 +289,15 @@ func handleEvent() {
 		case C.BLE_GATTC_EVT_HVX:
 			hvxEvent := gattcEvent.params.unionfield_hvx()
 			switch hvxEvent._type {
-			case C.BLE_GATT_HVX_NOTIFICATION:
+			case C.BLE_GATT_HVX_NOTIFICATION, C.BLE_GATT_HVX_INDICATION:
 				if debug {
 					println("evt: notification", hvxEvent.handle)
 				}
+				if hvxEvent._type == C.BLE_GATT_HVX_INDICATION {
+					// Indications must be confirmed before the server sends
+					// the next one.
+					C.sd_ble_gattc_hv_confirm(gattcEvent.conn_handle, hvxEvent.handle)
+				}
 				// Find the callback and call it (if there is any).
 				for _, callbackInfo := range gattcNotificationCallbacks {
 					if callbackInfo.valueHandle == hvxEvent.handle && callbackInfo.connectionHandle == gattcEvent.conn_handle {
@@ -226,6 +311,9 @@ func handleEvent() {
 					}
 				}
 			}
+		case C.BLE_GATTC_EVT_WRITE_CMD_TX_COMPLETE:
+			// A write command was sent, so there is space for the next one.
+			gattcWriteCmdTxComplete.Set(1)
 		default:
 			if debug {
 				println("unknown GATTC event:", id, id-C.BLE_GATTC_EVT_BASE)
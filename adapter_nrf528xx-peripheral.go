@@ -29,6 +29,7 @@ func handleEvent() {
 			}
 			currentConnection.Reg = gapEvent.conn_handle
 			DefaultAdapter.connectHandler(Address{}, true)
+			DefaultAdapter.addConnections(1)
 		case C.BLE_GAP_EVT_DISCONNECTED:
 			if debug {
 				println("evt: disconnected")
@@ -42,9 +43,45 @@ func handleEvent() {
 				// because it would need to be reconfigured as a non-connectable
 				// advertisement. That's left as a future addition, if
 				// necessary.
-				C.sd_ble_gap_adv_start(defaultAdvertisement.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+				defaultAdvertisement.start()
 			}
 			DefaultAdapter.connectHandler(Address{}, false)
+			DefaultAdapter.addConnections(-1)
+			if DefaultAdapter.disconnectHandler != nil {
+				disconnected := gapEvent.params.unionfield_disconnected()
+				DefaultAdapter.disconnectHandler(Connection(gapEvent.conn_handle), DisconnectReason(disconnected.reason))
+			}
+		case C.BLE_GAP_EVT_ADV_SET_TERMINATED:
+			advSetTerminated := gapEvent.params.unionfield_adv_set_terminated()
+			if debug {
+				println("evt: advertising set terminated:", advSetTerminated.reason)
+			}
+			if advSetTerminated.reason == C.BLE_GAP_EVT_ADV_SET_TERMINATED_REASON_TIMEOUT && defaultAdvertisement.isFast.Get() != 0 {
+				// The fast advertising phase ended, continue advertising at
+				// the slow interval.
+				if defaultAdvertisement.startSlow() == 0 {
+					break
+				}
+			}
+			// Advertising was stopped because of a timeout or event limit.
+			// Make sure it isn't restarted on disconnect.
+			defaultAdvertisement.isAdvertising.Set(0)
+			DefaultAdapter.setAdvertising(false)
+			if defaultAdvertisement.terminatedHandler != nil {
+				defaultAdvertisement.terminatedHandler(AdvertisementTerminateReason(advSetTerminated.reason))
+			}
+		case C.BLE_GAP_EVT_SCAN_REQ_REPORT:
+			scanReqReport := gapEvent.params.unionfield_scan_req_report()
+			if debug {
+				println("evt: scan request report")
+			}
+			if defaultAdvertisement.scanRequestHandler != nil {
+				scanner := Address{
+					MACAddress{MAC: scanReqReport.peer_addr.addr,
+						isRandom: scanReqReport.peer_addr.bitfield_addr_type() != 0},
+				}
+				defaultAdvertisement.scanRequestHandler(scanner, int16(scanReqReport.rssi))
+			}
 		case C.BLE_GAP_EVT_DATA_LENGTH_UPDATE_REQUEST:
 			// We need to respond with sd_ble_gap_data_length_update. Setting
 			// both parameters to nil will make sure we send the default values.
@@ -63,6 +100,7 @@ func handleEvent() {
 		}
 	case id >= C.BLE_GATTS_EVT_BASE && id <= C.BLE_GATTS_EVT_LAST:
 		gattsEvent := eventBuf.evt.unionfield_gatts_evt()
+		gattsActivity.Set(gattsActivity.Get() + 1)
 		switch id {
 		case C.BLE_GATTS_EVT_WRITE:
 			writeEvent := gattsEvent.params.unionfield_write()
@@ -57,5 +57,52 @@ func (a *Adapter) Address() (MACAddress, error) {
 	if errCode != 0 {
 		return MACAddress{}, Error(errCode)
 	}
-	return MACAddress{MAC: addr.addr}, nil
+	return MACAddress{MAC: addr.addr, isRandom: addr.bitfield_addr_type() != C.BLE_GAP_ADDR_TYPE_PUBLIC}, nil
+}
+
+// SetRandomAddress sets the address of this device to the given static random
+// address. The two most significant bits of the address must be set, as
+// required for static random addresses.
+//
+// By default, the SoftDevice uses a static random address that is programmed
+// into the chip at the factory.
+func (a *Adapter) SetRandomAddress(mac MAC) error {
+	if mac[5]>>6 != 0b11 {
+		return errNotStaticRandomAddress
+	}
+	var addr C.ble_gap_addr_t
+	addr.addr = mac
+	addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_STATIC)
+	errCode := C.sd_ble_gap_addr_set(&addr)
+	return makeError(errCode)
+}
+
+// SetTxPower sets the radio transmit power in dBm, for advertising and for the
+// current connection. A lower transmit power reduces the range, but also the
+// power consumption. The supported values depend on the chip, but -40, -20,
+// -16, -12, -8, -4, 0, 3 and 4 are supported by all nrf52 chips.
+//
+// The transmit power is also applied to advertisements configured later on.
+func (a *Adapter) SetTxPower(dBm int8) error {
+	if defaultAdvertisement.handle != C.BLE_GAP_ADV_SET_HANDLE_NOT_SET {
+		errCode := C.sd_ble_gap_tx_power_set(C.BLE_GAP_TX_POWER_ROLE_ADV, uint16(defaultAdvertisement.handle), dBm)
+		if errCode != 0 {
+			return Error(errCode)
+		}
+	}
+	if connHandle := currentConnection.Get(); connHandle != C.BLE_CONN_HANDLE_INVALID {
+		errCode := C.sd_ble_gap_tx_power_set(C.BLE_GAP_TX_POWER_ROLE_CONN, connHandle, dBm)
+		if errCode != 0 {
+			return Error(errCode)
+		}
+	}
+	a.txPower = dBm
+	return nil
+}
+
+// MaxConnections returns the maximum number of concurrent connections, in
+// either role. In the default SoftDevice configuration used here, this is a
+// single connection.
+func (a *Adapter) MaxConnections() int {
+	return C.BLE_GAP_CONN_COUNT_DEFAULT
 }
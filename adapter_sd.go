@@ -20,6 +20,9 @@ import "C"
 
 var (
 	ErrNotDefaultAdapter = errors.New("bluetooth: not the default adapter")
+
+	errNotStaticRandomAddress = errors.New("bluetooth: not a static random address")
+	errEmptyDeviceName        = errors.New("bluetooth: device name must not be empty")
 )
 
 var (
@@ -47,8 +50,19 @@ type Adapter struct {
 	isDefault         bool
 	scanning          bool
 	charWriteHandlers []charWriteHandler
-
-	connectHandler func(device Address, connected bool)
+	services          []*Service // added with AddService
+	txPower           int8       // in dBm, set by SetTxPower
+	deviceName        string     // set by SetDeviceName
+
+	connectHandler     func(device Address, connected bool)
+	disconnectHandler  func(connection Connection, reason DisconnectReason)
+	phyUpdateHandler   func(connection Connection, tx, rx PHY)
+	stateChangeHandler func(state AdapterState)
+	state              AdapterState
+	stateLock          stateLock
+	scanStarted        chan struct{} // closed when the next scan has started
+	scanParams         ScanParams
+	scanErrorHandler   func(result ScanResult, err error)
 }
 
 // DefaultAdapter is the default adapter on the current system. On Nordic chips,
@@ -112,6 +126,70 @@ func (a *Adapter) Enable() error {
 	return makeError(errCode)
 }
 
+// SetDeviceName sets the name of this device, as shown in the Device Name
+// characteristic of the GAP service. The default name is "TinyGo".
+//
+// The name is also advertised by advertisements that are configured
+// afterwards without an AdvertisementOptions.LocalName, shortened if it
+// doesn't fit. SetDeviceName is not available on Windows and macOS, where the
+// operating system manages the device name.
+func (a *Adapter) SetDeviceName(name string) error {
+	if len(name) == 0 {
+		return errEmptyDeviceName
+	}
+	buf := []byte(name)
+	errCode := C.sd_ble_gap_device_name_set(&secModeOpen, &buf[0], uint16(len(buf)))
+	if errCode != 0 {
+		return makeError(errCode)
+	}
+	a.deviceName = name
+	return nil
+}
+
+// ControllerInfo contains version information about the BLE controller.
+type ControllerInfo struct {
+	// Link Layer version, as listed in the Bluetooth Assigned Numbers. For
+	// example, 9 means Bluetooth 5.0.
+	Version uint8
+
+	// Company ID of the manufacturer. This is 0x0059 for Nordic
+	// Semiconductor.
+	Manufacturer uint16
+
+	// Link Layer subversion, which identifies the SoftDevice build (FWID).
+	Subversion uint16
+}
+
+// ControllerInfo returns version information about the controller, which can
+// be used to enable optional features at runtime.
+func (a *Adapter) ControllerInfo() (ControllerInfo, error) {
+	var version C.ble_version_t
+	errCode := C.sd_ble_version_get(&version)
+	if errCode != 0 {
+		return ControllerInfo{}, Error(errCode)
+	}
+	return ControllerInfo{
+		Version:      version.version_number,
+		Manufacturer: version.company_id,
+		Subversion:   version.subversion_number,
+	}, nil
+}
+
+// SetDisconnectHandler sets a handler that is called when a connection has
+// been terminated, with the reason why. This makes it possible to tell a
+// deliberate disconnect apart from a lost link, for example to only reconnect
+// in the latter case. It is called from an interrupt, after the connect
+// handler.
+func (a *Adapter) SetDisconnectHandler(handler func(connection Connection, reason DisconnectReason)) {
+	a.disconnectHandler = handler
+}
+
+// TxPower returns the radio transmit power in dBm, as set by SetTxPower. The
+// default is 0dBm.
+func (a *Adapter) TxPower() int8 {
+	return a.txPower
+}
+
 // DisableInterrupts must be used instead of disabling interrupts directly, to
 // play well with the SoftDevice. Restore interrupts to the previous state with
 // RestoreInterrupts.
@@ -0,0 +1,20 @@
+//go:build !softdevice
+
+package bluetooth
+
+import "sync"
+
+// stateLock guards the adapter state, which is updated from the goroutines
+// that receive events from the Bluetooth stack.
+type stateLock struct {
+	mutex sync.Mutex
+}
+
+func (l *stateLock) lock() uintptr {
+	l.mutex.Lock()
+	return 0
+}
+
+func (l *stateLock) unlock(mask uintptr) {
+	l.mutex.Unlock()
+}
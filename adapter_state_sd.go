@@ -0,0 +1,16 @@
+//go:build softdevice
+
+package bluetooth
+
+// stateLock guards the adapter state, which is updated from the SoftDevice
+// event interrupt. A mutex can't be used in an interrupt, so interrupts are
+// disabled instead.
+type stateLock struct{}
+
+func (l *stateLock) lock() uintptr {
+	return DisableInterrupts()
+}
+
+func (l *stateLock) unlock(mask uintptr) {
+	RestoreInterrupts(mask)
+}
@@ -12,7 +12,12 @@ import (
 type Adapter struct {
 	watcher *advertisement.BluetoothLEAdvertisementWatcher
 
-	connectHandler func(device Address, connected bool)
+	connectHandler     func(device Address, connected bool)
+	stateChangeHandler func(state AdapterState)
+	state              AdapterState
+	stateLock          stateLock
+	scanStarted        chan struct{} // closed when the next scan has started
+	scanParams         ScanParams
 }
 
 // DefaultAdapter is the default adapter on the system.
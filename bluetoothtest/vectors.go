@@ -0,0 +1,90 @@
+// Package bluetoothtest contains test vectors for Bluetooth data formats. They
+// are used by the tests of the bluetooth package, and can be reused by other
+// Bluetooth stacks and backends to test their own parsers.
+package bluetoothtest
+
+// AdvertisingData is an advertising payload together with the fields that a
+// parser should find in it.
+type AdvertisingData struct {
+	// Payload is the raw advertising payload, a sequence of AD structures.
+	Payload string
+
+	// LocalName is the complete local name, or the shortened local name if
+	// there is no complete one.
+	LocalName string
+
+	// ServiceUUIDs lists the advertised service UUIDs, in the canonical
+	// 128-bit string form.
+	ServiceUUIDs []string
+
+	// ManufacturerData maps company IDs to their manufacturer data.
+	ManufacturerData map[uint16][]byte
+}
+
+// AdvertisingDataVectors are advertising payloads with their expected
+// contents, following the AD structure formats of the Bluetooth Core
+// Specification Supplement, Part A.
+var AdvertisingDataVectors = []AdvertisingData{
+	{
+		Payload: "\x02\x01\x06", // flags
+	},
+	{
+		Payload: "\x02\x01\x06" + // flags
+			"\x05\x08Head" + // shortened local name
+			"\x07\x09foobar", // complete local name
+		LocalName: "foobar",
+	},
+	{
+		Payload: "\x02\x01\x06" + // flags
+			"\x05\x08Head", // shortened local name
+		LocalName: "Head",
+	},
+	{
+		Payload: "\x02\x01\x06" + // flags
+			"\x05\x02\x0d\x18\x0f\x18", // incomplete list of 16-bit UUIDs
+		ServiceUUIDs: []string{
+			"0000180d-0000-1000-8000-00805f9b34fb", // Heart Rate
+			"0000180f-0000-1000-8000-00805f9b34fb", // Battery
+		},
+	},
+	{
+		Payload: "\x02\x01\x06" + // flags
+			"\x09\x05\x0d\x18\x00\x00\x78\x56\x34\x12", // complete list of 32-bit UUIDs
+		ServiceUUIDs: []string{
+			"0000180d-0000-1000-8000-00805f9b34fb", // Heart Rate
+			"12345678-0000-1000-8000-00805f9b34fb",
+		},
+	},
+	{
+		Payload: "\x02\x01\x06" + // flags
+			"\x11\x07\x9e\xca\xdc\x24\x0e\xe5\xa9\xe0\x93\xf3\xa3\xb5\x01\x00\x40\x6e", // complete list of 128-bit UUIDs
+		ServiceUUIDs: []string{
+			"6e400001-b5a3-f393-e0a9-e50e24dcca9e", // Nordic UART
+		},
+	},
+	{
+		Payload: "\x02\x01\x06" + // flags
+			"\x07\xff\x59\x00\x01\x02\x03\x04", // manufacturer data
+		ManufacturerData: map[uint16][]byte{
+			0x0059: {0x01, 0x02, 0x03, 0x04},
+		},
+	},
+}
+
+// AddressHash is a test vector for the random address hash function ah, which
+// is used to create and resolve resolvable private addresses.
+type AddressHash struct {
+	IRK   [16]byte // identity resolving key, most significant byte first
+	Prand [3]byte  // random part of the address, most significant byte first
+	Hash  [3]byte  // ah(IRK, Prand), most significant byte first
+}
+
+// AddressHashVectors are test vectors for the random address hash function.
+var AddressHashVectors = []AddressHash{
+	{
+		// Bluetooth Core Specification, Vol 3, Part H, section D.7.
+		IRK:   [16]byte{0xec, 0x02, 0x34, 0xa3, 0x57, 0xc8, 0xad, 0x05, 0x34, 0x10, 0x10, 0xa6, 0x0a, 0x39, 0x7d, 0x9b},
+		Prand: [3]byte{0x70, 0x81, 0x94},
+		Hash:  [3]byte{0x0d, 0xfb, 0xaa},
+	},
+}
@@ -0,0 +1,191 @@
+//go:build !baremetal || (softdevice && s132v6) || (softdevice && s140v6) || (softdevice && s140v7)
+
+package bluetooth
+
+import (
+	"sync"
+	"time"
+)
+
+// How often a Reconnector checks whether its connection is still alive.
+const reconnectPollInterval = 100 * time.Millisecond
+
+// RetryParams configures ConnectWithRetry. Zero values are replaced by
+// reasonable defaults.
+type RetryParams struct {
+	// Delay before the first retry. The delay is doubled after every failed
+	// attempt, up to MaxDelay. The defaults are 1 second and 1 minute.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// Maximum number of connection attempts, or 0 to keep trying forever.
+	MaxAttempts int
+}
+
+// ConnectWithRetry is like Connect, but retries with exponential backoff when
+// the connection attempt fails, for example because the device is out of
+// range. It returns the error of the last attempt if all attempts failed.
+//
+// To also reconnect after an unexpected disconnect, use ConnectAutoReconnect.
+func (a *Adapter) ConnectWithRetry(address Address, params ConnectionParams, retry RetryParams) (*Device, error) {
+	return a.connectWithRetry(address, params, retry, nil)
+}
+
+// connectWithRetry implements ConnectWithRetry. It gives up early, returning
+// the last error, when the stop channel is closed.
+func (a *Adapter) connectWithRetry(address Address, params ConnectionParams, retry RetryParams, stop chan struct{}) (*Device, error) {
+	attempt := 0
+	for {
+		device, err := a.Connect(address, params)
+		if err == nil {
+			return device, nil
+		}
+		attempt++
+		if retry.MaxAttempts != 0 && attempt >= retry.MaxAttempts {
+			return nil, err
+		}
+		select {
+		case <-stop:
+			return nil, err
+		case <-time.After(retry.delay(attempt)):
+		}
+	}
+}
+
+// Reconnector keeps a connection to a device alive. It is returned by
+// ConnectAutoReconnect.
+type Reconnector struct {
+	adapter   *Adapter
+	address   Address
+	params    ConnectionParams
+	retry     RetryParams
+	connected func(device *Device)
+
+	lock   sync.Mutex
+	device *Device // current connection, nil while reconnecting
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// ConnectAutoReconnect connects to the device like ConnectWithRetry, and then
+// keeps the connection alive: when the connection is lost unexpectedly, for
+// example because the device went out of range, it is reconnected in the
+// background with the same retry parameters. If all attempts of a reconnect
+// fail, the Reconnector gives up.
+//
+// The connected callback is called with the new Device after every
+// successful connection, including the first one, before
+// ConnectAutoReconnect returns. Any state of the old connection, such as
+// discovered services or enabled notifications, must be set up again there.
+// The connect handler of the adapter reports every disconnect and reconnect
+// as usual.
+//
+// To end the connection, call Disconnect on the Reconnector instead of on
+// the Device, as the Device would otherwise be reconnected.
+func (a *Adapter) ConnectAutoReconnect(address Address, params ConnectionParams, retry RetryParams, connected func(device *Device)) (*Reconnector, error) {
+	device, err := a.ConnectWithRetry(address, params, retry)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reconnector{
+		adapter:   a,
+		address:   address,
+		params:    params,
+		retry:     retry,
+		connected: connected,
+		device:    device,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if connected != nil {
+		connected(device)
+	}
+	go r.run(device)
+	return r, nil
+}
+
+// run waits for the connection to be lost and reconnects, until Disconnect is
+// called or a reconnect fails.
+func (r *Reconnector) run(device *Device) {
+	defer close(r.done)
+	for {
+		// Wait until the connection is lost.
+		for device.isConnected() {
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(reconnectPollInterval):
+			}
+		}
+
+		// Release what's left of the old connection, ignoring the error as
+		// it's already gone.
+		r.lock.Lock()
+		r.device = nil
+		r.lock.Unlock()
+		device.Disconnect()
+
+		var err error
+		device, err = r.adapter.connectWithRetry(r.address, r.params, r.retry, r.stop)
+		if err != nil {
+			return
+		}
+		r.lock.Lock()
+		select {
+		case <-r.stop:
+			// Disconnect was called while reconnecting.
+			r.lock.Unlock()
+			device.Disconnect()
+			return
+		default:
+		}
+		r.device = device
+		r.lock.Unlock()
+		if r.connected != nil {
+			r.connected(device)
+		}
+	}
+}
+
+// Disconnect stops reconnecting and disconnects the current connection, if
+// there is one. It waits until a reconnect attempt in progress has finished.
+func (r *Reconnector) Disconnect() error {
+	r.lock.Lock()
+	select {
+	case <-r.stop:
+		// Already disconnected.
+		r.lock.Unlock()
+		return nil
+	default:
+	}
+	close(r.stop)
+	r.lock.Unlock()
+	<-r.done
+
+	r.lock.Lock()
+	device := r.device
+	r.device = nil
+	r.lock.Unlock()
+	if device == nil {
+		return nil
+	}
+	return device.Disconnect()
+}
+
+// delay returns how long to wait after the given number of failed attempts.
+func (retry RetryParams) delay(attempt int) time.Duration {
+	if retry.MinDelay == 0 {
+		retry.MinDelay = time.Second
+	}
+	if retry.MaxDelay == 0 {
+		retry.MaxDelay = time.Minute
+	}
+	delay := retry.MinDelay
+	for i := 1; i < attempt && delay < retry.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retry.MaxDelay {
+		delay = retry.MaxDelay
+	}
+	return delay
+}
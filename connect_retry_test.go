@@ -0,0 +1,30 @@
+//go:build !baremetal || (softdevice && s132v6) || (softdevice && s140v6) || (softdevice && s140v7)
+
+package bluetooth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	retry := RetryParams{MinDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, expected := range []time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		6: time.Second,
+	} {
+		if attempt == 0 {
+			continue
+		}
+		if delay := retry.delay(attempt); delay != expected {
+			t.Errorf("attempt %d: expected delay %v, got %v", attempt, expected, delay)
+		}
+	}
+	if delay := (RetryParams{}).delay(1); delay != time.Second {
+		t.Errorf("expected default delay of 1s, got %v", delay)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+// This example streams simulated sensor samples (for example from a
+// microphone or accelerometer) as notifications, using bluetooth.Stream. The
+// samples are produced at a fixed rate, independent of the connection. When
+// the link can't keep up, or when no central is subscribed, samples are
+// dropped, and the number of dropped bytes is printed every second.
+
+import (
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+var (
+	serviceUUID = bluetooth.NewUUID([16]byte{0x7a, 0x51, 0x00, 0x01, 0x5c, 0x2e, 0x4d, 0x8b, 0x9a, 0x1f, 0x3b, 0x60, 0x42, 0xd7, 0x8e, 0x13})
+	samplesUUID = serviceUUID.Replace16BitComponent(0x0002)
+)
+
+const (
+	sampleRate = 1000 // samples per second
+	packetSize = 20   // fits in a single notification with the default MTU
+	bufferSize = 512  // about half a second of samples
+)
+
+func main() {
+	println("starting")
+	adapter := bluetooth.DefaultAdapter
+	must("enable BLE stack", adapter.Enable())
+	adv := adapter.DefaultAdvertisement()
+	must("config adv", adv.Configure(bluetooth.AdvertisementOptions{
+		LocalName:    "Go Stream",
+		ServiceUUIDs: []bluetooth.UUID{serviceUUID},
+	}))
+	must("start adv", adv.Start())
+
+	var samples bluetooth.Characteristic
+	must("add service", adapter.AddService(&bluetooth.Service{
+		UUID: serviceUUID,
+		Characteristics: []bluetooth.CharacteristicConfig{
+			{
+				Handle: &samples,
+				UUID:   samplesUUID,
+				Flags:  bluetooth.CharacteristicNotifyPermission,
+			},
+		},
+	}))
+
+	stream := bluetooth.NewStream(&samples, bufferSize, packetSize)
+
+	// Drain the stream in the background. Errors are expected while no
+	// central is subscribed, or when the stack is out of buffers: in both
+	// cases the data stays buffered, so just try again a bit later.
+	go func() {
+		for {
+			stream.Send()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	// Produce samples at a fixed rate, in batches of 10ms.
+	var sample uint8
+	batch := make([]byte, sampleRate/100)
+	lastReport := time.Now()
+	for {
+		time.Sleep(10 * time.Millisecond)
+		for i := range batch {
+			batch[i] = sample // a sawtooth, as a stand-in for real samples
+			sample++
+		}
+		stream.Write(batch) // drops the samples that don't fit
+
+		if time.Since(lastReport) >= time.Second {
+			lastReport = time.Now()
+			stats := stream.Stats()
+			println("sent:", stats.SentBytes, "bytes in", stats.SentPackets, "packets, dropped:", stats.DroppedBytes, "bytes")
+		}
+	}
+}
+
+func must(action string, err error) {
+	if err != nil {
+		panic("failed to " + action + ": " + err.Error())
+	}
+}
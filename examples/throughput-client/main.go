@@ -0,0 +1,143 @@
+package main
+
+// This example is the central side of a throughput test, see
+// throughput-server for the peripheral side. It connects to the server and
+// measures:
+//
+//   - the round-trip latency, by writing a sequence number to the server and
+//     waiting for the server to echo it back in a notification
+//   - the notification throughput, by counting the data received from the
+//     server for a while
+//   - the write command (write without response) throughput, by sending data
+//     as fast as possible for a while; the server prints the rate at which it
+//     actually receives it
+//
+// Run it again after changing connection parameters or MTU to see the effect.
+
+import (
+	"sync/atomic"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+var (
+	serviceUUID = bluetooth.NewUUID([16]byte{0x1c, 0x9c, 0x00, 0x01, 0x3f, 0x46, 0x4b, 0x3a, 0x8f, 0x4e, 0x2a, 0x3c, 0x55, 0x6f, 0x0d, 0x21})
+	rxUUID      = serviceUUID.Replace16BitComponent(0x0002)
+	txUUID      = serviceUUID.Replace16BitComponent(0x0003)
+	pingUUID    = serviceUUID.Replace16BitComponent(0x0004)
+)
+
+// How long each measurement runs.
+const measureTime = 10 * time.Second
+
+// Number of pings for the latency measurement, and how long to wait for each
+// echo.
+const (
+	pingCount   = 20
+	pingTimeout = time.Second
+)
+
+var adapter = bluetooth.DefaultAdapter
+
+var received uint32
+
+// The last sequence number echoed by the server.
+var echoed uint32
+
+func main() {
+	must("enable BLE stack", adapter.Enable())
+
+	// Scan for the throughput server.
+	var foundDevice bluetooth.ScanResult
+	println("Scanning...")
+	must("scan", adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		if !result.AdvertisementPayload.HasServiceUUID(serviceUUID) {
+			return
+		}
+		foundDevice = result
+		adapter.StopScan()
+	}))
+
+	println("Connecting to", foundDevice.Address.String(), "...")
+	device, err := adapter.Connect(foundDevice.Address, bluetooth.ConnectionParams{})
+	must("connect", err)
+
+	services, err := device.DiscoverServices([]bluetooth.UUID{serviceUUID})
+	must("discover service", err)
+	chars, err := services[0].DiscoverCharacteristics([]bluetooth.UUID{rxUUID, txUUID, pingUUID})
+	must("discover characteristics", err)
+	rx, tx, ping := chars[0], chars[1], chars[2]
+
+	if mtu, err := rx.GetMTU(); err == nil {
+		println("MTU:", mtu)
+	}
+
+	// Measure the round-trip latency, before the notification measurement
+	// below keeps the link busy.
+	println("Measuring round-trip latency...")
+	must("enable ping notifications", ping.EnableNotifications(func(buf []byte) {
+		if len(buf) == 1 {
+			atomic.StoreUint32(&echoed, uint32(buf[0]))
+		}
+	}))
+	var minRTT, maxRTT, totalRTT time.Duration
+	pings := 0
+	for seq := uint32(1); seq <= pingCount; seq++ {
+		start := time.Now()
+		if _, err := ping.WriteWithoutResponse([]byte{byte(seq)}); err != nil {
+			continue
+		}
+		for atomic.LoadUint32(&echoed) != seq && time.Since(start) < pingTimeout {
+		}
+		rtt := time.Since(start)
+		if rtt >= pingTimeout {
+			println("ping", seq, "timed out")
+			continue
+		}
+		if pings == 0 || rtt < minRTT {
+			minRTT = rtt
+		}
+		if rtt > maxRTT {
+			maxRTT = rtt
+		}
+		totalRTT += rtt
+		pings++
+	}
+	if pings != 0 {
+		println("round trip: min", minRTT.Microseconds(), "us, avg", (totalRTT / time.Duration(pings)).Microseconds(), "us, max", maxRTT.Microseconds(), "us")
+	}
+
+	// Measure notification throughput.
+	println("Measuring notifications...")
+	must("enable notifications", tx.EnableNotifications(func(buf []byte) {
+		atomic.AddUint32(&received, uint32(len(buf)))
+	}))
+	atomic.StoreUint32(&received, 0)
+	time.Sleep(measureTime)
+	total := atomic.LoadUint32(&received)
+	println("notifications:", int(total)/int(measureTime/time.Second), "B/s")
+
+	// Measure write command throughput. The server reports how much data
+	// actually arrived.
+	println("Measuring write commands...")
+	var packet [20]byte
+	sent := 0
+	start := time.Now()
+	for time.Since(start) < measureTime {
+		packet[0]++
+		n, err := rx.WriteWithoutResponse(packet[:])
+		if err == nil {
+			sent += n
+		}
+	}
+	println("write commands:", sent/int(measureTime/time.Second), "B/s (as sent)")
+
+	must("disconnect", device.Disconnect())
+}
+
+func must(action string, err error) {
+	if err != nil {
+		panic("failed to " + action + ": " + err.Error())
+	}
+}
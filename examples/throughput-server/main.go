@@ -0,0 +1,107 @@
+package main
+
+// This example is the peripheral side of a throughput test, see
+// throughput-client for the central side. It sends notifications as fast as
+// possible and counts the data received through write commands (write without
+// response), printing both rates every second. It also echoes every value
+// written to the ping characteristic back as a notification, so that the
+// central can measure the round-trip latency.
+//
+// The rate of sent notifications is only meaningful while a central is
+// connected and subscribed. The central reports the rate at which it actually
+// receives them.
+
+import (
+	"sync/atomic"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+var (
+	serviceUUID = bluetooth.NewUUID([16]byte{0x1c, 0x9c, 0x00, 0x01, 0x3f, 0x46, 0x4b, 0x3a, 0x8f, 0x4e, 0x2a, 0x3c, 0x55, 0x6f, 0x0d, 0x21})
+	rxUUID      = serviceUUID.Replace16BitComponent(0x0002)
+	txUUID      = serviceUUID.Replace16BitComponent(0x0003)
+	pingUUID    = serviceUUID.Replace16BitComponent(0x0004)
+)
+
+// The payload size that fits in a single notification with the default MTU.
+const packetSize = 20
+
+var received uint32
+
+// The last value written to the ping characteristic plus one, or 0 if it has
+// been echoed already. It is echoed from the main loop instead of the write
+// event, which may run in an interrupt.
+var ping uint32
+
+func main() {
+	println("starting")
+	adapter := bluetooth.DefaultAdapter
+	must("enable BLE stack", adapter.Enable())
+	adv := adapter.DefaultAdvertisement()
+	must("config adv", adv.Configure(bluetooth.AdvertisementOptions{
+		LocalName:    "Throughput",
+		ServiceUUIDs: []bluetooth.UUID{serviceUUID},
+	}))
+	must("start adv", adv.Start())
+
+	var txChar, pingChar bluetooth.Characteristic
+	must("add service", adapter.AddService(&bluetooth.Service{
+		UUID: serviceUUID,
+		Characteristics: []bluetooth.CharacteristicConfig{
+			{
+				UUID:  rxUUID,
+				Flags: bluetooth.CharacteristicWriteWithoutResponsePermission,
+				WriteEvent: func(client bluetooth.Connection, offset int, value []byte) {
+					atomic.AddUint32(&received, uint32(len(value)))
+				},
+			},
+			{
+				Handle: &txChar,
+				UUID:   txUUID,
+				Flags:  bluetooth.CharacteristicNotifyPermission,
+			},
+			{
+				Handle: &pingChar,
+				UUID:   pingUUID,
+				Flags:  bluetooth.CharacteristicWriteWithoutResponsePermission | bluetooth.CharacteristicNotifyPermission,
+				WriteEvent: func(client bluetooth.Connection, offset int, value []byte) {
+					if len(value) == 1 {
+						atomic.StoreUint32(&ping, uint32(value[0])+1)
+					}
+				},
+			},
+		},
+	}))
+
+	var packet [packetSize]byte
+	sent := 0
+	start := time.Now()
+	for {
+		// Echo a ping as soon as possible, before sending more data.
+		if value := atomic.SwapUint32(&ping, 0); value != 0 {
+			pingChar.Write([]byte{byte(value - 1)})
+		}
+
+		// Send notifications as fast as the stack accepts them.
+		packet[0]++
+		n, err := txChar.Write(packet[:])
+		if err == nil {
+			sent += n
+		}
+
+		if elapsed := time.Since(start); elapsed >= time.Second {
+			received := atomic.SwapUint32(&received, 0)
+			println("sent:", sent*1000/int(elapsed.Milliseconds()), "B/s, received:", int(received)*1000/int(elapsed.Milliseconds()), "B/s")
+			sent = 0
+			start = time.Now()
+		}
+	}
+}
+
+func must(action string, err error) {
+	if err != nil {
+		panic("failed to " + action + ": " + err.Error())
+	}
+}
@@ -3,6 +3,7 @@ package bluetooth
 import (
 	"errors"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -11,6 +12,23 @@ var (
 	errAdvertisementPacketTooBig = errors.New("bluetooth: advertisement packet overflows")
 )
 
+// ErrConnectTimeout is returned by Connect when the device could not be
+// connected within the connection timeout.
+var ErrConnectTimeout = errors.New("bluetooth: timeout while connecting")
+
+// ErrMalformedAdvertisement is passed to the scan error handler (see
+// Adapter.SetScanErrorHandler) when an advertisement payload doesn't consist
+// of well-formed fields.
+var ErrMalformedAdvertisement = errors.New("bluetooth: malformed advertisement payload")
+
+// ErrServiceNotFound is returned by Device.GetService when the device doesn't
+// have a service with the requested UUID.
+var ErrServiceNotFound = errors.New("bluetooth: service not found")
+
+// ErrTooManyConnections is returned by Connect when the maximum number of
+// concurrent connections has been reached.
+var ErrTooManyConnections = errors.New("bluetooth: too many connections")
+
 // MACAddress contains a Bluetooth address which is a MAC address.
 type MACAddress struct {
 	// MAC address of the Bluetooth device.
@@ -57,8 +75,87 @@ type AdvertisementOptions struct {
 	// ManufacturerData stores Advertising Data.
 	// Keys are the Manufacturer ID to associate with the data.
 	ManufacturerData map[uint16]interface{}
+
+	// ServiceData contains data associated with a service UUID, stored in
+	// Service Data fields. This is also how the value of a characteristic
+	// with the broadcast permission is broadcast without a connection: as
+	// service data of its service.
+	ServiceData []ServiceDataElement
+
+	// ScanRequestHandler is called whenever a scanner sends a scan request
+	// for this advertisement, with the address of the scanner and the RSSI
+	// of the request. This can be used to count or identify who is observing
+	// the device.
+	//
+	// It is only supported on Nordic SoftDevices with advertising sets (S113,
+	// S132, S140) and ignored elsewhere. On the SoftDevice, the handler is
+	// called from an interrupt.
+	ScanRequestHandler func(scanner Address, rssi int16)
+
+	// Timeout is the time after which advertising is automatically stopped.
+	// MaxEvents is the number of advertising events after which advertising
+	// is automatically stopped. When zero, there is no such limit.
+	//
+	// TerminatedHandler, if set, is called when advertising was stopped
+	// because of one of these limits, so the application can restart it or
+	// switch to a different payload.
+	//
+	// These options are only supported on Nordic SoftDevices with advertising
+	// sets (S113, S132, S140) and ignored elsewhere. The timeout is rounded up
+	// to 10ms and can be at most 655.35 seconds; Configure returns an error
+	// for longer timeouts.
+	Timeout           time.Duration
+	MaxEvents         uint8
+	TerminatedHandler func(reason AdvertisementTerminateReason)
+	// FastInterval and FastTimeout enable a fast advertising phase: after
+	// Start, and after a disconnect, the device first advertises at
+	// FastInterval for FastTimeout, so that it is found and connected to
+	// quickly. Then it automatically falls back to Interval, which should be
+	// slower to save power. Apple recommends 20ms for at least 30 seconds,
+	// followed by one of the longer intervals listed in the Accessory Design
+	// Guidelines. The fast phase is disabled when FastTimeout is zero. Like
+	// Timeout, FastTimeout can be at most 655.35 seconds.
+	//
+	// These options are only supported on Nordic SoftDevices with advertising
+	// sets (S113, S132, S140) and ignored elsewhere.
+	FastInterval Duration
+	FastTimeout  time.Duration
+
+	// IncludeTxPower adds a TX Power Level field with the transmit power of
+	// the advertisement, so that scanners can estimate the path loss (and
+	// thus the distance) from the received signal strength. On Nordic
+	// SoftDevices, this is the power set with Adapter.SetTxPower, which must
+	// be called before Configure. On Linux, BlueZ fills in the value.
+	IncludeTxPower bool
+
+	// Transmit power in dBm for the TX Power Level field, filled in by the
+	// backend when IncludeTxPower is set.
+	txPowerLevel int8
 }
 
+// ServiceDataElement is a single Service Data field in an advertisement.
+type ServiceDataElement struct {
+	// UUID of the service. 16-bit UUIDs take the least space.
+	UUID UUID
+
+	// Data associated with the service.
+	Data []byte
+}
+
+// AdvertisementTerminateReason is the reason why advertising was stopped
+// automatically, see AdvertisementOptions.
+type AdvertisementTerminateReason uint8
+
+// Reasons why advertising was stopped automatically.
+const (
+	// AdvertisementTimeout means the advertisement timeout was reached.
+	AdvertisementTimeout AdvertisementTerminateReason = 1
+
+	// AdvertisementLimitReached means the maximum number of advertising
+	// events was reached.
+	AdvertisementLimitReached AdvertisementTerminateReason = 2
+)
+
 // Duration is the unit of time used in BLE, in 0.625µs units. This unit of time
 // is used throughout the BLE stack.
 type Duration uint16
@@ -73,6 +170,41 @@ func NewDuration(interval time.Duration) Duration {
 // Connection is a numeric identifier that indicates a connection handle.
 type Connection uint16
 
+// DisconnectReason is the HCI error code that says why a connection was
+// terminated, see SetDisconnectHandler.
+type DisconnectReason uint8
+
+// Common reasons why a connection was terminated. See the Bluetooth Core
+// Specification, Vol 1, Part F for the complete list.
+const (
+	// The supervision timeout expired, usually because the remote device
+	// went out of range.
+	DisconnectReasonConnectionTimeout DisconnectReason = 0x08
+
+	// The remote device terminated the connection, for example because the
+	// user closed the app, or because it is low on resources or powering
+	// off.
+	DisconnectReasonRemoteUser         DisconnectReason = 0x13
+	DisconnectReasonRemoteLowResources DisconnectReason = 0x14
+	DisconnectReasonRemotePowerOff     DisconnectReason = 0x15
+
+	// The connection was terminated locally, for example with
+	// Device.Disconnect.
+	DisconnectReasonLocalHost DisconnectReason = 0x16
+
+	// The connection was lost because of a message integrity check failure
+	// on an encrypted link.
+	DisconnectReasonMICFailure DisconnectReason = 0x3D
+
+	// The connection could not be established, because the remote device
+	// didn't respond after it was created.
+	DisconnectReasonFailedToEstablish DisconnectReason = 0x3E
+)
+
+// PHY is a bitmask of LE physical layers (PHYs), see Device.SetPHY. It is only
+// used on Nordic SoftDevices that support Bluetooth 5.
+type PHY uint8
+
 // ScanResult contains information from when an advertisement packet was
 // received. It is passed as a parameter to the callback of the Scan method.
 type ScanResult struct {
@@ -82,6 +214,12 @@ type ScanResult struct {
 	// RSSI the last time a packet from this device has been received.
 	RSSI int16
 
+	// PDUType describes the kind of advertising packet this scan result was
+	// received in. It is only reported on Nordic SoftDevices: BlueZ,
+	// CoreBluetooth and the WinRT bindings in use don't expose it, so it is
+	// always zero on other platforms.
+	PDUType AdvertisementPDUType
+
 	// The data obtained from the advertisement data, which may contain many
 	// different properties.
 	// Warning: this data may only stay valid until the next event arrives. If
@@ -90,6 +228,24 @@ type ScanResult struct {
 	AdvertisementPayload
 }
 
+// AdvertisementPDUType is a set of flags that describes an advertising packet
+// (PDU). A non-connectable advertisement (ADV_NONCONN_IND) has no flags set.
+type AdvertisementPDUType uint8
+
+const (
+	// The advertiser accepts connections (ADV_IND or ADV_DIRECT_IND).
+	AdvertisementConnectable AdvertisementPDUType = 1 << iota
+
+	// The advertiser accepts scan requests (ADV_IND or ADV_SCAN_IND).
+	AdvertisementScannable
+
+	// The advertisement is directed at this device (ADV_DIRECT_IND).
+	AdvertisementDirected
+
+	// The packet is a scan response (SCAN_RSP) to an active scan.
+	AdvertisementScanResponse
+)
+
 // AdvertisementPayload contains information obtained during a scan (see
 // ScanResult). It is provided as an interface as there are two possible
 // implementations: an implementation that works with raw data (usually on
@@ -187,6 +343,10 @@ func (buf *rawAdvertisementPayload) findField(fieldType byte) []byte {
 	data := buf.Bytes()
 	for len(data) >= 2 {
 		fieldLength := data[0]
+		if fieldLength == 0 {
+			// A zero length marks the end of the significant part.
+			return nil
+		}
 		if int(fieldLength)+1 > len(data) {
 			// Invalid field length.
 			return nil
@@ -199,6 +359,24 @@ func (buf *rawAdvertisementPayload) findField(fieldType byte) []byte {
 	return nil
 }
 
+// validate checks that the advertisement packet consists of well-formed
+// fields, and returns ErrMalformedAdvertisement if it doesn't.
+func (buf *rawAdvertisementPayload) validate() error {
+	data := buf.Bytes()
+	for len(data) != 0 {
+		fieldLength := data[0]
+		if fieldLength == 0 {
+			// The rest of the packet is padding.
+			return nil
+		}
+		if int(fieldLength)+1 > len(data) {
+			return ErrMalformedAdvertisement
+		}
+		data = data[fieldLength+1:]
+	}
+	return nil
+}
+
 // LocalName returns the local name (complete or shortened) in the advertisement
 // payload.
 func (buf *rawAdvertisementPayload) LocalName() string {
@@ -214,8 +392,8 @@ func (buf *rawAdvertisementPayload) LocalName() string {
 }
 
 // HasServiceUUID returns true whether the given UUID is present in the
-// advertisement payload as a Service Class UUID. It checks both 16-bit UUIDs
-// and 128-bit UUIDs.
+// advertisement payload as a Service Class UUID. It checks 16-bit, 32-bit and
+// 128-bit UUIDs.
 func (buf *rawAdvertisementPayload) HasServiceUUID(uuid UUID) bool {
 	if uuid.Is16Bit() {
 		b := buf.findField(0x03) // Complete List of 16-bit Service Class UUIDs
@@ -229,6 +407,21 @@ func (buf *rawAdvertisementPayload) HasServiceUUID(uuid UUID) bool {
 				return true
 			}
 		}
+		// A 16-bit UUID may also be listed in its 32-bit form, so continue
+		// below.
+	}
+	if uuid.Is32Bit() {
+		b := buf.findField(0x05) // Complete List of 32-bit Service Class UUIDs
+		if len(b) == 0 {
+			b = buf.findField(0x04) // Incomplete List of 32-bit Service Class UUIDs
+		}
+		uuid := uuid.Get32Bit()
+		for i := 0; i < len(b)/4; i++ {
+			foundUUID := uint32(b[i*4]) | (uint32(b[i*4+1]) << 8) | (uint32(b[i*4+2]) << 16) | (uint32(b[i*4+3]) << 24)
+			if uuid == foundUUID {
+				return true
+			}
+		}
 		return false
 	} else {
 		b := buf.findField(0x07) // Complete List of 128-bit Service Class UUIDs
@@ -263,8 +456,9 @@ func (buf *rawAdvertisementPayload) ManufacturerData() map[uint16][]byte {
 			// Invalid field length.
 			return nil
 		}
-		// If this is the manufacturer data
-		if byte(0xFF) == data[1] {
+		// If this is the manufacturer data. It must at least contain the
+		// 16-bit manufacturer ID.
+		if byte(0xFF) == data[1] && fieldLength >= 3 {
 			mData[uint16(data[2])+(uint16(data[3])<<8)] = data[4 : fieldLength+1]
 		}
 		data = data[fieldLength+1:]
@@ -282,13 +476,38 @@ func (buf *rawAdvertisementPayload) reset() {
 // addFromOptions constructs a new advertisement payload (assumed to be empty
 // before the call) from the advertisement options. It returns true if it fits,
 // false otherwise.
+//
+// If the local name doesn't fit together with the other fields, it is
+// shortened and added as a Shortened Local Name field instead.
 func (buf *rawAdvertisementPayload) addFromOptions(options AdvertisementOptions) (ok bool) {
 	buf.addFlags(0x06)
 	if options.LocalName != "" {
-		if !buf.addCompleteLocalName(options.LocalName) {
+		// Find out how much space is left for the name, by constructing the
+		// rest of the payload separately.
+		var rest rawAdvertisementPayload
+		if !rest.addFields(options) {
 			return false
 		}
+		space := len(buf.data) - int(buf.len) - int(rest.len) - 2
+		if len(options.LocalName) <= space {
+			buf.addCompleteLocalName(options.LocalName)
+		} else {
+			// Don't cut a multibyte UTF-8 character in half.
+			for space > 0 && !utf8.RuneStart(options.LocalName[space]) {
+				space--
+			}
+			if space < 1 {
+				return false // not even a single character of the name fits
+			}
+			buf.addShortenedLocalName(options.LocalName[:space])
+		}
 	}
+	return buf.addFields(options)
+}
+
+// addFields adds the fields from the advertisement options other than the
+// flags and the local name. It returns true if they fit, false otherwise.
+func (buf *rawAdvertisementPayload) addFields(options AdvertisementOptions) (ok bool) {
 	// TODO: if there are multiple 16-bit UUIDs, they should be listed in
 	// one field.
 	// This is not possible for 128-bit service UUIDs (at least not in
@@ -301,7 +520,21 @@ func (buf *rawAdvertisementPayload) addFromOptions(options AdvertisementOptions)
 	}
 
 	if len(options.ManufacturerData) > 0 {
-		buf.addManufacturerData(options.ManufacturerData)
+		if !buf.addManufacturerData(options.ManufacturerData) {
+			return false
+		}
+	}
+
+	for _, element := range options.ServiceData {
+		if !buf.addServiceData(element.UUID, element.Data) {
+			return false
+		}
+	}
+
+	if options.IncludeTxPower {
+		if !buf.addTxPowerLevel(options.txPowerLevel) {
+			return false
+		}
 	}
 
 	return true
@@ -311,7 +544,11 @@ func (buf *rawAdvertisementPayload) addFromOptions(options AdvertisementOptions)
 func (buf *rawAdvertisementPayload) addManufacturerData(manufacturerData map[uint16]interface{}) (ok bool) {
 	payloadData := buf.Bytes()
 	for manufacturerID, rawData := range manufacturerData {
-		data := rawData.([]byte)
+		data, ok := rawData.([]byte)
+		if !ok {
+			// Only raw byte slices can be put in the advertisement packet.
+			return false
+		}
 		// Check if the manufacturer ID is within the range of 16 bits (0-65535).
 		if manufacturerID > 0xFFFF {
 			// Invalid manufacturer ID.
@@ -328,6 +565,9 @@ func (buf *rawAdvertisementPayload) addManufacturerData(manufacturerData map[uin
 		payloadData = append(payloadData, byte(fieldLength), manufacturerDataBit, manufacturerIDPart1, manufacturerIDPart2)
 		payloadData = append(payloadData, data...)
 	}
+	if len(payloadData) > len(buf.data) {
+		return false // manufacturer data doesn't fit
+	}
 	buf.len = uint8(len(payloadData))
 	copy(buf.data[:], payloadData)
 	return true
@@ -361,12 +601,35 @@ func (buf *rawAdvertisementPayload) addCompleteLocalName(name string) (ok bool)
 	return true
 }
 
-// addServiceUUID adds a Service Class UUID (16-bit or 128-bit). It has
+// addTxPowerLevel adds the TX Power Level field, in dBm, to the advertisement
+// buffer. It returns true on success and false if it doesn't fit.
+func (buf *rawAdvertisementPayload) addTxPowerLevel(dBm int8) (ok bool) {
+	if int(buf.len)+3 > len(buf.data) {
+		return false // doesn't fit
+	}
+
+	buf.data[buf.len] = 2      // length of field (including type)
+	buf.data[buf.len+1] = 0x0a // type, 0x0a means TX Power Level
+	buf.data[buf.len+2] = byte(dBm)
+	buf.len += 3
+	return true
+}
+
+// addShortenedLocalName adds the Shortened Local Name field to the
+// advertisement buffer. It returns true on success (the name fits) and false
+// on failure.
+func (buf *rawAdvertisementPayload) addShortenedLocalName(name string) (ok bool) {
+	if !buf.addCompleteLocalName(name) {
+		return false
+	}
+	buf.data[int(buf.len)-len(name)-1] = 8 // type, 0x08 means Shortened Local Name
+	return true
+}
+
+// addServiceUUID adds a Service Class UUID (16-bit, 32-bit or 128-bit). It has
 // currently only been designed for adding single UUIDs: multiple UUIDs are
 // stored in separate fields without joining them together in one field.
 func (buf *rawAdvertisementPayload) addServiceUUID(uuid UUID) (ok bool) {
-	// Don't bother with 32-bit UUID support, it doesn't seem to be used in
-	// practice.
 	if uuid.Is16Bit() {
 		if int(buf.len)+4 > len(buf.data) {
 			return false // UUID doesn't fit.
@@ -378,6 +641,19 @@ func (buf *rawAdvertisementPayload) addServiceUUID(uuid UUID) (ok bool) {
 		buf.data[buf.len+3] = byte(shortUUID >> 8)
 		buf.len += 4
 		return true
+	} else if uuid.Is32Bit() {
+		if int(buf.len)+6 > len(buf.data) {
+			return false // UUID doesn't fit.
+		}
+		shortUUID := uuid.Get32Bit()
+		buf.data[buf.len+0] = 5    // length of field, including type
+		buf.data[buf.len+1] = 0x05 // type, 0x05 means "Complete List of 32-bit Service Class UUIDs"
+		buf.data[buf.len+2] = byte(shortUUID)
+		buf.data[buf.len+3] = byte(shortUUID >> 8)
+		buf.data[buf.len+4] = byte(shortUUID >> 16)
+		buf.data[buf.len+5] = byte(shortUUID >> 24)
+		buf.len += 6
+		return true
 	} else {
 		if int(buf.len)+18 > len(buf.data) {
 			return false // UUID doesn't fit.
@@ -391,10 +667,44 @@ func (buf *rawAdvertisementPayload) addServiceUUID(uuid UUID) (ok bool) {
 	}
 }
 
+// addServiceData adds a Service Data field, with a 16-bit, 32-bit or 128-bit
+// UUID depending on the UUID. It returns true on success (the data fits) and
+// false on failure.
+func (buf *rawAdvertisementPayload) addServiceData(uuid UUID, data []byte) (ok bool) {
+	var fieldType byte
+	var rawUUID []byte
+	if uuid.Is16Bit() {
+		shortUUID := uuid.Get16Bit()
+		fieldType = 0x16 // Service Data - 16-bit UUID
+		rawUUID = []byte{byte(shortUUID), byte(shortUUID >> 8)}
+	} else if uuid.Is32Bit() {
+		shortUUID := uuid.Get32Bit()
+		fieldType = 0x20 // Service Data - 32-bit UUID
+		rawUUID = []byte{byte(shortUUID), byte(shortUUID >> 8), byte(shortUUID >> 16), byte(shortUUID >> 24)}
+	} else {
+		fullUUID := uuid.Bytes()
+		fieldType = 0x21 // Service Data - 128-bit UUID
+		rawUUID = fullUUID[:]
+	}
+	fieldLength := 1 + len(rawUUID) + len(data) // including type
+	if int(buf.len)+1+fieldLength > len(buf.data) {
+		return false // service data doesn't fit
+	}
+	buf.data[buf.len] = byte(fieldLength)
+	buf.data[buf.len+1] = fieldType
+	copy(buf.data[buf.len+2:], rawUUID)
+	copy(buf.data[int(buf.len)+2+len(rawUUID):], data)
+	buf.len += byte(1 + fieldLength)
+	return true
+}
+
 // ConnectionParams are used when connecting to a peripherals.
 type ConnectionParams struct {
 	// The timeout for the connection attempt. Not used during the rest of the
 	// connection. If no duration is specified, a default timeout will be used.
+	// When it expires, Connect returns ErrConnectTimeout. On Windows, Connect
+	// doesn't wait for the connection to be established, so it has no
+	// timeout.
 	ConnectionTimeout Duration
 
 	// Minimum and maximum connection interval. The shorter the interval, the
@@ -403,4 +713,14 @@ type ConnectionParams struct {
 	// will be used.
 	MinInterval Duration
 	MaxInterval Duration
+
+	// PeripheralLatency is the number of connection events the peripheral
+	// may skip when it has no data to send, which saves power on the
+	// peripheral. It is zero by default.
+	PeripheralLatency uint16
+
+	// Timeout is the supervision timeout: the connection is considered lost
+	// when no packet has been received for this long. If it is not
+	// specified, a default timeout will be used.
+	Timeout Duration
 }
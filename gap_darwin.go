@@ -56,6 +56,8 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) (err error) {
 	a.cm.Scan(nil, &cbgo.CentralManagerScanOpts{
 		AllowDuplicates: false,
 	})
+	a.setScanning(true)
+	defer a.setScanning(false)
 
 	// Check whether the scan is stopped. This is necessary to avoid a race
 	// condition between the signal channel and the cancelScan channel when
@@ -143,6 +145,7 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 			p.SetDelegate(d.delegate)
 
 			a.connectHandler(address, true)
+			a.addConnections(1)
 
 			return d, nil
 
@@ -151,7 +154,7 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 			a.cm.CancelConnect(prphs[0])
 
 			// record an error to use when the disconnect comes through later.
-			connectionError = errors.New("timeout on Connect")
+			connectionError = ErrConnectTimeout
 
 			// we are not ready to return yet, we need to wait for the disconnect event to come through
 			// so continue on from this case and wait for something to show up on prphCh
@@ -167,6 +170,11 @@ func (d *Device) Disconnect() error {
 	return nil
 }
 
+// isConnected returns whether the connection is still alive.
+func (d *Device) isConnected() bool {
+	return d.prph.State() == cbgo.PeripheralStateConnected
+}
+
 // Peripheral delegate functions
 
 type peripheralDelegate struct {
@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/muka/go-bluetooth/api"
@@ -16,6 +17,8 @@ import (
 
 var errAdvertisementNotStarted = errors.New("bluetooth: stop advertisement that was not started")
 
+const defaultConnectionTimeout time.Duration = 10 * time.Second
+
 // Address contains a Bluetooth MAC address.
 type Address struct {
 	MACAddress
@@ -54,9 +57,22 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 		LocalName:        options.LocalName,
 		ManufacturerData: options.ManufacturerData,
 	}
+	if options.IncludeTxPower {
+		a.properties.Includes = append(a.properties.Includes, "tx-power")
+	}
+	if options.LocalName == "" && a.adapter.deviceName != "" {
+		// Let BlueZ add the alias set by SetDeviceName.
+		a.properties.Includes = append(a.properties.Includes, "local-name")
+	}
 	for _, uuid := range options.ServiceUUIDs {
 		a.properties.ServiceUUIDs = append(a.properties.ServiceUUIDs, uuid.String())
 	}
+	if len(options.ServiceData) != 0 {
+		a.properties.ServiceData = make(map[string]interface{}, len(options.ServiceData))
+		for _, element := range options.ServiceData {
+			a.properties.ServiceData[element.UUID.String()] = element.Data
+		}
+	}
 
 	return nil
 }
@@ -71,6 +87,7 @@ func (a *Advertisement) Start() error {
 		return err
 	}
 	a.cancel = cancel
+	a.adapter.setAdvertising(true)
 	return nil
 }
 
@@ -80,6 +97,7 @@ func (a *Advertisement) Stop() error {
 		return errAdvertisementNotStarted
 	}
 	a.cancel()
+	a.adapter.setAdvertising(false)
 	return nil
 }
 
@@ -155,6 +173,8 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 	if err != nil {
 		return err
 	}
+	a.setScanning(true)
+	defer a.setScanning(false)
 
 	for {
 		// Check whether the scan is stopped. This is necessary to avoid a race
@@ -174,8 +194,17 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 			// to check for signals that are relevant to us.
 			switch sig.Name {
 			case "org.freedesktop.DBus.ObjectManager.InterfacesAdded":
-				objectPath := sig.Body[0].(dbus.ObjectPath)
-				interfaces := sig.Body[1].(map[string]map[string]dbus.Variant)
+				if len(sig.Body) < 2 {
+					continue
+				}
+				objectPath, ok := sig.Body[0].(dbus.ObjectPath)
+				if !ok {
+					continue
+				}
+				interfaces, ok := sig.Body[1].(map[string]map[string]dbus.Variant)
+				if !ok {
+					continue
+				}
 				rawprops, ok := interfaces["org.bluez.Device1"]
 				if !ok {
 					continue
@@ -185,25 +214,42 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 				devices[objectPath] = props
 				callback(a, makeScanResult(props))
 			case "org.freedesktop.DBus.Properties.PropertiesChanged":
-				interfaceName := sig.Body[0].(string)
+				if len(sig.Body) < 2 {
+					continue
+				}
+				interfaceName, _ := sig.Body[0].(string)
 				if interfaceName != "org.bluez.Device1" {
 					continue
 				}
-				changes := sig.Body[1].(map[string]dbus.Variant)
+				changes, ok := sig.Body[1].(map[string]dbus.Variant)
+				if !ok {
+					continue
+				}
 				props := devices[sig.Path]
+				if props == nil {
+					// A property change of a device we haven't seen added.
+					continue
+				}
 				for field, val := range changes {
 					switch field {
 					case "RSSI":
-						props.RSSI = val.Value().(int16)
+						if rssi, ok := val.Value().(int16); ok {
+							props.RSSI = rssi
+						}
 					case "Name":
-						props.Name = val.Value().(string)
+						if name, ok := val.Value().(string); ok {
+							props.Name = name
+						}
 					case "UUIDs":
-						props.UUIDs = val.Value().([]string)
+						if uuids, ok := val.Value().([]string); ok {
+							props.UUIDs = uuids
+						}
 					case "ManufacturerData":
 						// work around for https://github.com/muka/go-bluetooth/issues/163
 						mData := make(map[uint16]interface{})
-						for k, v := range val.Value().(map[uint16]dbus.Variant) {
-							mData[k] = v.Value().(interface{})
+						rawData, _ := val.Value().(map[uint16]dbus.Variant)
+						for k, v := range rawData {
+							mData[k] = v.Value()
 						}
 						props.ManufacturerData = mData
 					}
@@ -251,7 +297,9 @@ func makeScanResult(props *device.Device1Properties) ScanResult {
 		// can be either variant or just byte value
 		switch val := v.(type) {
 		case dbus.Variant:
-			mData[k] = val.Value().([]byte)
+			if data, ok := val.Value().([]byte); ok {
+				mData[k] = data
+			}
 		case []byte:
 			mData[k] = val
 		}
@@ -278,6 +326,7 @@ type Device struct {
 	propchanged chan *bluez.PropertyChanged // channel that device property changes will show up on
 	adapter     *Adapter                    // the adapter that was used to form this device connection
 	address     Address                     // the address of the device
+	services    map[UUID]*DeviceService     // services returned by GetService
 }
 
 // Connect starts a connection attempt to the given peripheral device address.
@@ -301,10 +350,25 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 	if !dev.Properties.Connected {
 		// Not yet connected, so do it now.
 		// The properties have just been read so this is fresh data.
-		err := dev.Connect()
-		if err != nil {
+		timeout := defaultConnectionTimeout
+		if params.ConnectionTimeout != 0 {
+			timeout = time.Duration(int64(params.ConnectionTimeout)*625) * time.Microsecond
+		}
+		connectErr := make(chan error, 1)
+		go func() {
+			connectErr <- dev.Connect()
+		}()
+		select {
+		case err := <-connectErr:
+			if err != nil {
+				device.cancel() // cancel our watcher routine
+				return nil, err
+			}
+		case <-time.After(timeout):
+			// BlueZ cancels a pending connection attempt on Disconnect.
+			dev.Disconnect()
 			device.cancel() // cancel our watcher routine
-			return nil, err
+			return nil, ErrConnectTimeout
 		}
 	}
 
@@ -319,6 +383,12 @@ func (d *Device) Disconnect() error {
 	return d.device.Disconnect()
 }
 
+// isConnected returns whether the connection is still alive. The context is
+// canceled by watchForConnect when the device disconnects.
+func (d *Device) isConnected() bool {
+	return d.ctx.Err() == nil
+}
+
 // watchForConnect watches for a signal from the bluez device interface that indicates a Connection/Disconnection.
 //
 // We can add extra signals to watch for here,
@@ -346,7 +416,10 @@ func (d *Device) watchForConnect() error {
 					// Send off a notification indicating we have connected or disconnected
 					d.adapter.connectHandler(d.address, d.device.Properties.Connected)
 
-					if !d.device.Properties.Connected {
+					if d.device.Properties.Connected {
+						d.adapter.addConnections(1)
+					} else {
+						d.adapter.addConnections(-1)
 						d.cancel()
 						return
 					}
@@ -48,6 +48,10 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 
 	// Construct payload.
 	var payload rawAdvertisementPayload
+	options.txPowerLevel = DefaultAdapter.txPower
+	if options.LocalName == "" {
+		options.LocalName = DefaultAdapter.deviceName
+	}
 	if !payload.addFromOptions(options) {
 		return errAdvertisementPacketTooBig
 	}
@@ -60,6 +64,7 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 // Start advertisement. May only be called after it has been configured.
 func (a *Advertisement) Start() error {
 	a.isAdvertising.Set(1)
+	DefaultAdapter.setAdvertising(true)
 	errCode := a.start()
 	return makeError(errCode)
 }
@@ -67,6 +72,7 @@ func (a *Advertisement) Start() error {
 // Stop advertisement.
 func (a *Advertisement) Stop() error {
 	a.isAdvertising.Set(0)
+	DefaultAdapter.setAdvertising(false)
 	errCode := C.sd_ble_gap_adv_stop()
 	return makeError(errCode)
 }
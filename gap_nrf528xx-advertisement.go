@@ -3,6 +3,7 @@
 package bluetooth
 
 import (
+	"errors"
 	"runtime/volatile"
 	"time"
 )
@@ -12,6 +13,8 @@ import (
 */
 import "C"
 
+var errAdvertisementTimeout = errors.New("bluetooth: advertisement timeout out of range")
+
 // Address contains a Bluetooth MAC address.
 type Address struct {
 	MACAddress
@@ -22,6 +25,17 @@ type Advertisement struct {
 	handle        uint8
 	isAdvertising volatile.Register8
 	payload       rawAdvertisementPayload
+
+	// Advertising parameters, kept around to switch between the fast and the
+	// slow advertising phase.
+	data       C.ble_gap_adv_data_t
+	params     C.ble_gap_adv_params_t
+	fastParams C.ble_gap_adv_params_t
+	hasFast    bool
+	isFast     volatile.Register8
+
+	scanRequestHandler func(scanner Address, rssi int16)
+	terminatedHandler  func(reason AdvertisementTerminateReason)
 }
 
 // The nrf528xx devices only seem to support one advertisement instance. The way
@@ -46,40 +60,121 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 		// https://developer.apple.com/accessories/Accessory-Design-Guidelines.pdf
 		options.Interval = NewDuration(152500 * time.Microsecond) // 152.5ms
 	}
+	duration, err := advDuration(options.Timeout)
+	if err != nil {
+		return err
+	}
+	fastDuration, err := advDuration(options.FastTimeout)
+	if err != nil {
+		return err
+	}
 
 	// Construct payload.
 	// Note that the payload needs to be part of the Advertisement object as the
 	// memory is still used after sd_ble_gap_adv_set_configure returns.
 	a.payload.reset()
+	options.txPowerLevel = DefaultAdapter.txPower
+	if options.LocalName == "" {
+		options.LocalName = DefaultAdapter.deviceName
+	}
 	if !a.payload.addFromOptions(options) {
 		return errAdvertisementPacketTooBig
 	}
 
-	data := C.ble_gap_adv_data_t{}
-	data.adv_data = C.ble_data_t{
+	a.data = C.ble_gap_adv_data_t{}
+	a.data.adv_data = C.ble_data_t{
 		p_data: &a.payload.data[0],
 		len:    uint16(a.payload.len),
 	}
-	params := C.ble_gap_adv_params_t{
+	a.params = C.ble_gap_adv_params_t{
 		properties: C.ble_gap_adv_properties_t{
 			_type: C.BLE_GAP_ADV_TYPE_CONNECTABLE_SCANNABLE_UNDIRECTED,
 		},
-		interval: uint32(options.Interval),
+		interval:     uint32(options.Interval),
+		duration:     duration,
+		max_adv_evts: options.MaxEvents,
+	}
+	if options.ScanRequestHandler != nil {
+		a.params.set_bitfield_scan_req_notification(1)
+	}
+	a.scanRequestHandler = options.ScanRequestHandler
+	a.terminatedHandler = options.TerminatedHandler
+
+	// The fast phase uses the same parameters, except for the interval and
+	// the duration. Start configures it before advertising starts.
+	a.hasFast = options.FastTimeout != 0
+	a.isFast.Set(0)
+	if a.hasFast {
+		if options.FastInterval == 0 {
+			options.FastInterval = NewDuration(20 * time.Millisecond)
+		}
+		a.fastParams = a.params
+		a.fastParams.interval = uint32(options.FastInterval)
+		a.fastParams.duration = fastDuration
+	}
+
+	errCode := C.sd_ble_gap_adv_set_configure(&a.handle, &a.data, &a.params)
+	if errCode != 0 {
+		return Error(errCode)
+	}
+
+	// Apply the transmit power set with SetTxPower, if any. A new advertising
+	// set starts at the default of 0dBm.
+	if DefaultAdapter.txPower != 0 {
+		errCode = C.sd_ble_gap_tx_power_set(C.BLE_GAP_TX_POWER_ROLE_ADV, uint16(a.handle), DefaultAdapter.txPower)
 	}
-	errCode := C.sd_ble_gap_adv_set_configure(&a.handle, &data, &params)
 	return makeError(errCode)
 }
 
+// advDuration converts an advertising timeout to the SoftDevice format, in
+// 10ms units. Timeouts are rounded up, so that a short timeout doesn't become
+// zero, which means no timeout at all. The longest possible timeout is
+// 655.35 seconds; longer ones return an error instead of silently wrapping
+// around.
+func advDuration(timeout time.Duration) (uint16, error) {
+	const unit = 10 * time.Millisecond
+	if timeout < 0 || timeout > 0xffff*unit {
+		return 0, errAdvertisementTimeout
+	}
+	return uint16((timeout + unit - 1) / unit), nil
+}
+
 // Start advertisement. May only be called after it has been configured.
 func (a *Advertisement) Start() error {
 	a.isAdvertising.Set(1)
-	errCode := C.sd_ble_gap_adv_start(a.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+	DefaultAdapter.setAdvertising(true)
+	errCode := a.start()
 	return makeError(errCode)
 }
 
+// start starts advertising, beginning with the fast phase if there is one. It
+// is also used to restart advertising after a disconnect, from an interrupt.
+func (a *Advertisement) start() uint32 {
+	if a.hasFast {
+		errCode := C.sd_ble_gap_adv_set_configure(&a.handle, &a.data, &a.fastParams)
+		if errCode != 0 {
+			return errCode
+		}
+		a.isFast.Set(1)
+	}
+	return C.sd_ble_gap_adv_start(a.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+}
+
+// startSlow switches to the slow advertising phase once the fast phase has
+// timed out. It is called from an interrupt.
+func (a *Advertisement) startSlow() uint32 {
+	a.isFast.Set(0)
+	errCode := C.sd_ble_gap_adv_set_configure(&a.handle, &a.data, &a.params)
+	if errCode != 0 {
+		return errCode
+	}
+	return C.sd_ble_gap_adv_start(a.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+}
+
 // Stop advertisement.
 func (a *Advertisement) Stop() error {
 	a.isAdvertising.Set(0)
+	DefaultAdapter.setAdvertising(false)
 	errCode := C.sd_ble_gap_adv_stop(a.handle)
 	return makeError(errCode)
 }
@@ -10,11 +10,18 @@ import (
 )
 
 /*
+#include "ble.h"
 #include "ble_gap.h"
+#include "nrf_error.h"
 */
 import "C"
 
-var errAlreadyConnecting = errors.New("bluetooth: already in a connection attempt")
+var (
+	errAlreadyConnecting = errors.New("bluetooth: already in a connection attempt")
+	errAcceptListTooLong = errors.New("bluetooth: too many addresses for the accept list")
+	errConnectionParams  = errors.New("bluetooth: invalid connection parameters")
+	errEmptyAcceptList   = errors.New("bluetooth: the accept list is empty")
+)
 
 // Memory buffers needed by sd_ble_gap_scan_start.
 var (
@@ -23,6 +30,58 @@ var (
 	globalScanResult ScanResult
 )
 
+// Memory buffers needed by sd_ble_gap_whitelist_set.
+var (
+	acceptListAddrs    [C.BLE_GAP_WHITELIST_ADDR_MAX_COUNT]C.ble_gap_addr_t
+	acceptListPointers [C.BLE_GAP_WHITELIST_ADDR_MAX_COUNT]*C.ble_gap_addr_t
+	acceptListLen      uint8
+)
+
+// SetAcceptList sets the filter accept list (also known as white list) of the
+// controller. While the list is not empty, Scan only reports advertisements
+// from the devices in the list, which avoids waking up the CPU for all the
+// other devices nearby. Passing an empty list clears the filter.
+//
+// At most 8 addresses are supported. The list can't be changed while a scan is
+// in progress.
+func (a *Adapter) SetAcceptList(addresses []Address) error {
+	if len(addresses) > len(acceptListAddrs) {
+		return errAcceptListTooLong
+	}
+	for i, address := range addresses {
+		acceptListAddrs[i] = makeGAPAddr(address)
+		acceptListPointers[i] = &acceptListAddrs[i]
+	}
+	var errCode uint32
+	if len(addresses) == 0 {
+		errCode = C.sd_ble_gap_whitelist_set(nil, 0)
+	} else {
+		errCode = C.sd_ble_gap_whitelist_set(&acceptListPointers[0], uint8(len(addresses)))
+	}
+	if errCode != 0 {
+		return Error(errCode)
+	}
+	acceptListLen = uint8(len(addresses))
+	return nil
+}
+
+// SetScanErrorHandler sets a handler that is called instead of the scan
+// callback for scan results that could not be parsed, for example because the
+// advertisement payload is malformed. The error describes what is wrong with
+// the scan result. This can be used to log or count bad packets, without
+// having to handle them in the scan callback.
+//
+// Without a handler, such scan results are passed to the scan callback as
+// usual: the functions that parse the payload never panic, but may return
+// incomplete data.
+//
+// This is only available on Nordic SoftDevices, which pass raw advertisement
+// payloads to the application. Other platforms parse them in the operating
+// system.
+func (a *Adapter) SetScanErrorHandler(handler func(result ScanResult, err error)) {
+	a.scanErrorHandler = handler
+}
+
 // Scan starts a BLE scan. It is stopped by a call to StopScan. A common pattern
 // is to cancel the scan when a particular device has been found.
 //
@@ -36,12 +95,24 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 		return errScanning
 	}
 	a.scanning = true
+	a.setScanning(true)
 
 	scanParams := C.ble_gap_scan_params_t{}
 	scanParams.set_bitfield_extended(0)
-	scanParams.set_bitfield_active(0)
+	if a.scanParams.Mode == ScanModeActive {
+		scanParams.set_bitfield_active(1)
+	} else {
+		scanParams.set_bitfield_active(0)
+	}
+	if acceptListLen != 0 {
+		scanParams.set_bitfield_filter_policy(C.BLE_GAP_SCAN_FP_WHITELIST)
+	}
 	scanParams.interval = uint16(NewDuration(40 * time.Millisecond))
 	scanParams.window = uint16(NewDuration(30 * time.Millisecond))
+	if a.scanParams.Interval != 0 && a.scanParams.Window != 0 {
+		scanParams.interval = uint16(a.scanParams.Interval)
+		scanParams.window = uint16(a.scanParams.Window)
+	}
 	scanParams.timeout = C.BLE_GAP_SCAN_TIMEOUT_UNLIMITED
 	scanReportBufferInfo := C.ble_data_t{
 		p_data: &scanReportBuffer.data[0],
@@ -49,6 +120,8 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 	}
 	errCode := C.sd_ble_gap_scan_start(&scanParams, &scanReportBufferInfo)
 	if errCode != 0 {
+		a.scanning = false
+		a.setScanning(false)
 		return Error(errCode)
 	}
 
@@ -64,8 +137,13 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 		}
 		gotScanReport.Set(0)
 
-		// Call the callback with the scan result.
-		callback(a, globalScanResult)
+		// Call the callback with the scan result, or the scan error handler if
+		// the payload is malformed.
+		if err := scanReportBuffer.validate(); err != nil && a.scanErrorHandler != nil {
+			a.scanErrorHandler(globalScanResult, err)
+		} else {
+			callback(a, globalScanResult)
+		}
 
 		// Restart the advertisement. This is needed, because advertisements are
 		// automatically stopped when the first packet arrives.
@@ -85,6 +163,7 @@ func (a *Adapter) StopScan() error {
 		return errNotScanning
 	}
 	a.scanning = false
+	a.setScanning(false)
 
 	// TODO: stop immediately, not when the next scan result arrives.
 
@@ -94,11 +173,19 @@ func (a *Adapter) StopScan() error {
 // Device is a connection to a remote peripheral.
 type Device struct {
 	connectionHandle uint16
+	disconnects      uint32 // disconnectCounts of the handle when connected
+
+	services map[UUID]*DeviceService // services returned by GetService
 }
 
+// Number of times each connection handle was disconnected, incremented by the
+// event handler. A Device compares it with the count at connection time to
+// detect that it was disconnected, even if the handle is reused by now.
+var disconnectCounts [C.BLE_GAP_CONN_COUNT_DEFAULT]volatile.Register32
+
 // In-progress connection attempt.
 var connectionAttempt struct {
-	state            volatile.Register8 // 0 means unused, 1 means connecting, 2 means ready (connected or timeout)
+	state            volatile.Register8 // 0 means unused, 1 means connecting, 2 means connected, 3 means timeout
 	connectionHandle uint16
 }
 
@@ -110,30 +197,39 @@ var connectionAttempt struct {
 // you can reuse that address directly.
 func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, error) {
 	// Construct an address object as used in the SoftDevice.
-	var addr C.ble_gap_addr_t
-	addr.addr = address.MAC
-	if address.IsRandom() {
-		switch address.MAC[5] >> 6 {
-		case 0b11:
-			addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_STATIC)
-		case 0b01:
-			addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_PRIVATE_RESOLVABLE)
-		case 0b00:
-			addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_PRIVATE_NON_RESOLVABLE)
-		}
-	}
+	addr := makeGAPAddr(address)
 
 	// Pick default values if some parameters aren't specified.
 	if params.ConnectionTimeout == 0 {
 		params.ConnectionTimeout = NewDuration(4 * time.Second)
 	}
-	if params.MinInterval == 0 && params.MaxInterval == 0 {
-		// Pick some semi-arbitrary range if these values haven't been
-		// configured. The values have been picked to be compliant with the
-		// guidelines from Apple (section 35.6 Connection Parameters):
-		// https://developer.apple.com/accessories/Accessory-Design-Guidelines.pdf
-		params.MinInterval = NewDuration(15 * time.Millisecond)
-		params.MaxInterval = NewDuration(150 * time.Millisecond)
+	return a.connect(&addr, C.BLE_GAP_SCAN_FP_ACCEPT_ALL, params)
+}
+
+// ConnectAny connects to the first device from the filter accept list (see
+// SetAcceptList) that is seen advertising. The controller does this by itself,
+// without reporting advertisements to the CPU, which is an efficient way to
+// wait for any of a set of known devices to come into range.
+//
+// Unlike in Connect, a zero ConnectionTimeout means there is no timeout. To
+// accept multiple devices, call ConnectAny again after it returns.
+func (a *Adapter) ConnectAny(params ConnectionParams) (*Device, error) {
+	if acceptListLen == 0 {
+		return nil, errEmptyAcceptList
+	}
+	return a.connect(nil, C.BLE_GAP_SCAN_FP_WHITELIST, params)
+}
+
+// connect starts a connection attempt and waits for it to finish. The address
+// is ignored (and may be nil) when connecting to the filter accept list.
+func (a *Adapter) connect(addr *C.ble_gap_addr_t, filterPolicy uint8, params ConnectionParams) (*Device, error) {
+	if a.State().Connections >= a.MaxConnections() {
+		return nil, ErrTooManyConnections
+	}
+
+	connectionParams, err := makeConnParams(params)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set scan params, presumably these parameters are used to re-scan for the
@@ -142,16 +238,10 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 	scanParams := C.ble_gap_scan_params_t{}
 	scanParams.set_bitfield_extended(0)
 	scanParams.set_bitfield_active(0)
+	scanParams.set_bitfield_filter_policy(filterPolicy)
 	scanParams.interval = uint16(NewDuration(40 * time.Millisecond))
 	scanParams.window = uint16(NewDuration(30 * time.Millisecond))
-	scanParams.timeout = uint16(params.ConnectionTimeout)
-
-	connectionParams := C.ble_gap_conn_params_t{
-		min_conn_interval: uint16(params.MinInterval) / 2,
-		max_conn_interval: uint16(params.MaxInterval) / 2,
-		slave_latency:     0,   // mostly relevant to connected keyboards etc
-		conn_sup_timeout:  200, // 2 seconds (in 10ms units), the minimum recommended by Apple
-	}
+	scanParams.timeout = uint16(params.ConnectionTimeout) / 16 // in 10ms units
 
 	// Flag to the event handler that we are waiting for incoming connections.
 	// This should be safe as long as Connect is not called concurrently. And
@@ -162,7 +252,7 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 	connectionAttempt.state.Set(1)
 
 	// Start the connection attempt. We'll get a signal in the event handler.
-	errCode := C.sd_ble_gap_connect(&addr, &scanParams, &connectionParams, C.BLE_CONN_CFG_TAG_DEFAULT)
+	errCode := C.sd_ble_gap_connect(addr, &scanParams, &connectionParams, C.BLE_CONN_CFG_TAG_DEFAULT)
 	if errCode != 0 {
 		connectionAttempt.state.Set(0)
 		return nil, Error(errCode)
@@ -171,20 +261,225 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 	// Wait until the connection is established.
 	// TODO: use some sort of condition variable once the scheduler supports
 	// them.
-	for connectionAttempt.state.Get() != 2 {
+	for connectionAttempt.state.Get() < 2 {
 		arm.Asm("wfe")
 	}
+	if connectionAttempt.state.Get() == 3 {
+		// The SoftDevice stopped the connection attempt.
+		connectionAttempt.state.Set(0)
+		return nil, ErrConnectTimeout
+	}
 	connectionHandle := connectionAttempt.connectionHandle
 	connectionAttempt.state.Set(0)
 
 	// Connection has been established.
-	return &Device{
+	device := &Device{
 		connectionHandle: connectionHandle,
+	}
+	if int(connectionHandle) < len(disconnectCounts) {
+		device.disconnects = disconnectCounts[connectionHandle].Get()
+	}
+	return device, nil
+}
+
+// makeConnParams converts the connection parameters to the SoftDevice format,
+// filling in defaults for the parameters that aren't specified.
+func makeConnParams(params ConnectionParams) (C.ble_gap_conn_params_t, error) {
+	// Pick default values if some parameters aren't specified.
+	if params.MinInterval == 0 && params.MaxInterval == 0 {
+		// Pick some semi-arbitrary range if these values haven't been
+		// configured. The values have been picked to be compliant with the
+		// guidelines from Apple (section 35.6 Connection Parameters):
+		// https://developer.apple.com/accessories/Accessory-Design-Guidelines.pdf
+		params.MinInterval = NewDuration(15 * time.Millisecond)
+		params.MaxInterval = NewDuration(150 * time.Millisecond)
+	}
+	if params.Timeout == 0 {
+		// 2 seconds, the minimum recommended by Apple.
+		params.Timeout = NewDuration(2 * time.Second)
+	}
+
+	// Check the parameters against the limits in the Bluetooth Core
+	// Specification (Vol 6, Part B, section 4.5.1 and 4.5.2).
+	if params.MinInterval < NewDuration(7500*time.Microsecond) ||
+		params.MaxInterval > NewDuration(4*time.Second) ||
+		params.MinInterval > params.MaxInterval ||
+		params.PeripheralLatency > 499 ||
+		params.Timeout < NewDuration(100*time.Millisecond) ||
+		params.Timeout > NewDuration(32*time.Second) ||
+		uint32(params.Timeout) <= (1+uint32(params.PeripheralLatency))*uint32(params.MaxInterval)*2 {
+		return C.ble_gap_conn_params_t{}, errConnectionParams
+	}
+
+	return C.ble_gap_conn_params_t{
+		min_conn_interval: uint16(params.MinInterval) / 2, // in 1.25ms units
+		max_conn_interval: uint16(params.MaxInterval) / 2, // in 1.25ms units
+		slave_latency:     params.PeripheralLatency,       // mostly relevant to connected keyboards etc
+		conn_sup_timeout:  uint16(params.Timeout) / 16,    // in 10ms units
 	}, nil
 }
 
+// RequestConnectionParams requests new connection parameters for this
+// connection. Only MinInterval, MaxInterval, PeripheralLatency and Timeout
+// are used; the same defaults as in Connect apply when they are zero.
+//
+// The update happens in the background and the remote device may reject it.
+func (d *Device) RequestConnectionParams(params ConnectionParams) error {
+	connectionParams, err := makeConnParams(params)
+	if err != nil {
+		return err
+	}
+	errCode := C.sd_ble_gap_conn_param_update(d.connectionHandle, &connectionParams)
+	if errCode != 0 {
+		return Error(errCode)
+	}
+	return nil
+}
+
+// The PHYs supported by the SoftDevice.
+const (
+	// PHY1M is the 1Mbps PHY, which is supported by all devices.
+	PHY1M PHY = C.BLE_GAP_PHY_1MBPS
+
+	// PHY2M is the 2Mbps PHY, which doubles the raw throughput at the cost of
+	// a slightly shorter range.
+	PHY2M PHY = C.BLE_GAP_PHY_2MBPS
+
+	// PHYCoded is the coded PHY, which increases the range at the cost of a
+	// much lower throughput. It is only supported by the S140 SoftDevice.
+	PHYCoded PHY = C.BLE_GAP_PHY_CODED
+)
+
+// SetPHY requests the given preferred PHYs for sending (tx) and receiving (rx)
+// on this connection. Multiple PHYs may be combined, in which case the
+// controllers pick one of them. Passing zero lets the SoftDevice choose.
+//
+// The update happens in the background; use SetPHYUpdateHandler to be notified
+// when it has completed.
+func (d *Device) SetPHY(tx, rx PHY) error {
+	phys := C.ble_gap_phys_t{
+		tx_phys: uint8(tx),
+		rx_phys: uint8(rx),
+	}
+	errCode := C.sd_ble_gap_phy_update(d.connectionHandle, &phys)
+	if errCode != 0 {
+		return Error(errCode)
+	}
+	return nil
+}
+
+// SetPHYUpdateHandler sets a handler that is called when the PHY of a
+// connection has changed, either after a call to Device.SetPHY or because the
+// remote device requested it.
+func (a *Adapter) SetPHYUpdateHandler(handler func(connection Connection, tx, rx PHY)) {
+	a.phyUpdateHandler = handler
+}
+
+// RequestDataLength starts a data length update, which allows a single link
+// layer packet to carry up to octets bytes of payload (27 to 251) in both
+// directions. Larger packets greatly improve throughput, especially together
+// with a larger ATT MTU. Passing zero picks the largest value supported by the
+// SoftDevice configuration.
+//
+// The update happens in the background and the remote device may pick a
+// smaller value.
+func (d *Device) RequestDataLength(octets uint16) error {
+	params := C.ble_gap_data_length_params_t{
+		max_tx_octets:  octets,
+		max_rx_octets:  octets,
+		max_tx_time_us: C.BLE_GAP_DATA_LENGTH_AUTO,
+		max_rx_time_us: C.BLE_GAP_DATA_LENGTH_AUTO,
+	}
+	errCode := C.sd_ble_gap_data_length_update(d.connectionHandle, &params, nil)
+	if errCode != 0 {
+		return Error(errCode)
+	}
+	return nil
+}
+
+// RSSI returns the signal strength of the last packets received on this
+// connection, in dBm.
+//
+// The first call starts RSSI measurements on the connection, so it waits for
+// the next connection event to get a sample.
+func (d *Device) RSSI() (int8, error) {
+	var rssi int8
+	var channel uint8
+	errCode := C.sd_ble_gap_rssi_get(d.connectionHandle, &rssi, &channel)
+	if errCode == C.NRF_ERROR_INVALID_STATE {
+		// RSSI reporting has not been started yet on this connection.
+		errCode = C.sd_ble_gap_rssi_start(d.connectionHandle, C.BLE_GAP_RSSI_THRESHOLD_INVALID, 0)
+		if errCode != 0 {
+			return 0, Error(errCode)
+		}
+		errCode = C.sd_ble_gap_rssi_get(d.connectionHandle, &rssi, &channel)
+	}
+	for errCode == C.NRF_ERROR_NOT_FOUND {
+		// No sample is available yet. The connection may be disconnected in
+		// the meantime, in which case a different error is returned.
+		time.Sleep(5 * time.Millisecond)
+		errCode = C.sd_ble_gap_rssi_get(d.connectionHandle, &rssi, &channel)
+	}
+	if errCode != 0 {
+		return 0, Error(errCode)
+	}
+	return rssi, nil
+}
+
+// ChannelMap returns the channel map currently used by this connection. Each
+// bit represents one of the 37 data channels, with bit 0 of the first byte
+// being channel 0. Unused channels are skipped by adaptive frequency hopping.
+func (d *Device) ChannelMap() ([5]byte, error) {
+	var opt C.ble_opt_t
+	chMap := opt.unionfield_gap_opt().unionfield_ch_map()
+	chMap.conn_handle = d.connectionHandle
+	errCode := C.sd_ble_opt_get(C.BLE_GAP_OPT_CH_MAP, &opt)
+	if errCode != 0 {
+		return [5]byte{}, Error(errCode)
+	}
+	return chMap.ch_map, nil
+}
+
+// SetChannelMap sets the data channels that may be used by connections, in
+// the same format as returned by Device.ChannelMap. This can be used to avoid
+// channels that are known to be busy, for example because of a nearby Wi-Fi
+// network. At least two channels must be enabled, and the channel map can be
+// changed at most once per second.
+//
+// The channel map applies to all current and future connections in the
+// central role.
+func (a *Adapter) SetChannelMap(channels [5]byte) error {
+	var opt C.ble_opt_t
+	chMap := opt.unionfield_gap_opt().unionfield_ch_map()
+	chMap.ch_map = channels
+	errCode := C.sd_ble_opt_set(C.BLE_GAP_OPT_CH_MAP, &opt)
+	return makeError(errCode)
+}
+
+// makeGAPAddr converts an address to the address object used in the
+// SoftDevice.
+func makeGAPAddr(address Address) C.ble_gap_addr_t {
+	var addr C.ble_gap_addr_t
+	addr.addr = address.MAC
+	if address.IsRandom() {
+		switch address.MAC[5] >> 6 {
+		case 0b11:
+			addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_STATIC)
+		case 0b01:
+			addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_PRIVATE_RESOLVABLE)
+		case 0b00:
+			addr.set_bitfield_addr_type(C.BLE_GAP_ADDR_TYPE_RANDOM_PRIVATE_NON_RESOLVABLE)
+		}
+	}
+	return addr
+}
+
 // Disconnect from the BLE device.
 func (d *Device) Disconnect() error {
+	if !d.isConnected() {
+		// The connection handle may belong to a different connection by now.
+		return nil
+	}
 	errCode := C.sd_ble_gap_disconnect(d.connectionHandle, C.BLE_HCI_REMOTE_USER_TERMINATED_CONNECTION)
 	if errCode != 0 {
 		return Error(errCode)
@@ -192,3 +487,11 @@ func (d *Device) Disconnect() error {
 
 	return nil
 }
+
+// isConnected returns whether the connection is still alive.
+func (d *Device) isConnected() bool {
+	if int(d.connectionHandle) >= len(disconnectCounts) {
+		return true
+	}
+	return disconnectCounts[d.connectionHandle].Get() == d.disconnects
+}
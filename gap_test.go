@@ -1,8 +1,11 @@
 package bluetooth
 
 import (
+	"reflect"
 	"testing"
 	"time"
+
+	"tinygo.org/x/bluetooth/bluetoothtest"
 )
 
 func TestCreateAdvertisementPayload(t *testing.T) {
@@ -55,6 +58,15 @@ func TestCreateAdvertisementPayload(t *testing.T) {
 				},
 			},
 		},
+		{
+			raw: "\x02\x01\x06" + // flags
+				"\x05\x05\x78\x56\x34\x12", // 32-bit service UUID
+			parsed: AdvertisementOptions{
+				ServiceUUIDs: []UUID{
+					New32BitUUID(0x12345678),
+				},
+			},
+		},
 	}
 	for _, tc := range tests {
 		var expectedRaw rawAdvertisementPayload
@@ -68,3 +80,179 @@ func TestCreateAdvertisementPayload(t *testing.T) {
 		}
 	}
 }
+
+func TestMalformedAdvertisementPayload(t *testing.T) {
+	// None of these should panic.
+	tests := []string{
+		"",
+		"\x00",
+		"\x05\x09ab",           // field length beyond end of packet
+		"\x01\xff",             // manufacturer data without manufacturer ID
+		"\x02\xff\x59",         // manufacturer data with truncated manufacturer ID
+		"\x02\x01\x06\x02\x03", // truncated 16-bit UUID list
+	}
+	for _, tc := range tests {
+		var raw rawAdvertisementPayload
+		raw.len = uint8(len(tc))
+		copy(raw.data[:], tc)
+		raw.LocalName()
+		raw.HasServiceUUID(ServiceUUIDHeartRate)
+		raw.HasServiceUUID(NewUUID([16]byte{}))
+		if data := raw.ManufacturerData(); len(data) != 0 {
+			t.Errorf("expected no manufacturer data for %#v, got %#v", tc, data)
+		}
+	}
+}
+
+func TestAdvertisementPayloadTooBig(t *testing.T) {
+	var raw rawAdvertisementPayload
+	ok := raw.addFromOptions(AdvertisementOptions{
+		LocalName: "foobar",
+		ManufacturerData: map[uint16]interface{}{
+			0x0059: []byte("this is way too long to fit"),
+		},
+	})
+	if ok {
+		t.Errorf("expected manufacturer data to overflow the advertisement packet")
+	}
+
+	raw.reset()
+	ok = raw.addFromOptions(AdvertisementOptions{
+		ManufacturerData: map[uint16]interface{}{
+			0x0059: "not a byte slice",
+		},
+	})
+	if ok {
+		t.Errorf("expected manufacturer data of the wrong type to be rejected")
+	}
+}
+
+func TestAdvertisementShortenedLocalName(t *testing.T) {
+	var raw rawAdvertisementPayload
+	ok := raw.addFromOptions(AdvertisementOptions{
+		LocalName: "a very long device name",
+		ManufacturerData: map[uint16]interface{}{
+			0x0059: []byte("some data"),
+		},
+	})
+	if !ok {
+		t.Fatal("expected the name to be shortened to fit")
+	}
+	if raw.len != 31 {
+		t.Errorf("expected the packet to be filled completely, got %d bytes", raw.len)
+	}
+	if name := raw.LocalName(); name != "a very long d" {
+		t.Errorf("unexpected shortened name: %q", name)
+	}
+	if raw.findField(0x08) == nil {
+		t.Error("expected a Shortened Local Name field")
+	}
+	if data := raw.ManufacturerData()[0x0059]; string(data) != "some data" {
+		t.Errorf("unexpected manufacturer data: %q", data)
+	}
+}
+
+func TestAdvertisementServiceData(t *testing.T) {
+	var raw rawAdvertisementPayload
+	ok := raw.addFromOptions(AdvertisementOptions{
+		ServiceData: []ServiceDataElement{
+			{UUID: New16BitUUID(0x181a), Data: []byte{0x12, 0x34}},
+			{UUID: New32BitUUID(0x12345678), Data: []byte{0x56}},
+		},
+	})
+	if !ok {
+		t.Fatal("expected service data to fit")
+	}
+	expected := []byte{
+		0x02, 0x01, 0x06, // flags
+		0x05, 0x16, 0x1a, 0x18, 0x12, 0x34, // 16-bit service data
+		0x06, 0x20, 0x78, 0x56, 0x34, 0x12, 0x56, // 32-bit service data
+	}
+	if !reflect.DeepEqual(raw.Bytes(), expected) {
+		t.Errorf("unexpected payload:\nexpected: %x\nactual:   %x", expected, raw.Bytes())
+	}
+
+	raw.reset()
+	ok = raw.addFromOptions(AdvertisementOptions{
+		ServiceData: []ServiceDataElement{
+			{UUID: ServiceUUIDNordicUART, Data: []byte("too long to fit")},
+		},
+	})
+	if ok {
+		t.Error("expected 128-bit service data to overflow the advertisement packet")
+	}
+}
+
+func TestParseAdvertisementPayload(t *testing.T) {
+	for _, tc := range bluetoothtest.AdvertisingDataVectors {
+		var raw rawAdvertisementPayload
+		raw.len = uint8(len(tc.Payload))
+		copy(raw.data[:], tc.Payload)
+
+		if raw.LocalName() != tc.LocalName {
+			t.Errorf("expected local name %#v for %#v, got %#v", tc.LocalName, tc.Payload, raw.LocalName())
+		}
+		for _, s := range tc.ServiceUUIDs {
+			uuid, err := ParseUUID(s)
+			if err != nil {
+				t.Fatal("invalid UUID in test vector:", err)
+			}
+			if !raw.HasServiceUUID(uuid) {
+				t.Errorf("expected service UUID %s in %#v", uuid, tc.Payload)
+			}
+		}
+		if len(tc.ServiceUUIDs) == 0 && raw.HasServiceUUID(ServiceUUIDHeartRate) {
+			t.Errorf("unexpected service UUID in %#v", tc.Payload)
+		}
+		manufacturerData := raw.ManufacturerData()
+		if len(manufacturerData) != 0 || len(tc.ManufacturerData) != 0 {
+			if !reflect.DeepEqual(manufacturerData, tc.ManufacturerData) {
+				t.Errorf("expected manufacturer data %#v in %#v, got %#v", tc.ManufacturerData, tc.Payload, manufacturerData)
+			}
+		}
+	}
+}
+
+func TestAdvertisementTxPower(t *testing.T) {
+	var raw rawAdvertisementPayload
+	options := AdvertisementOptions{IncludeTxPower: true}
+	options.txPowerLevel = -4
+	if !raw.addFromOptions(options) {
+		t.Fatal("expected TX power level to fit")
+	}
+	expected := []byte{
+		0x02, 0x01, 0x06, // flags
+		0x02, 0x0a, 0xfc, // TX power level
+	}
+	if !reflect.DeepEqual(raw.Bytes(), expected) {
+		t.Errorf("unexpected payload:\nexpected: %x\nactual:   %x", expected, raw.Bytes())
+	}
+}
+
+func TestAdvertisementValidate(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte{}, nil},
+		{[]byte{0x02, 0x01, 0x06, 0x03, 0x09, 'a', 'b'}, nil},
+		{[]byte{0x02, 0x01, 0x06, 0x00, 0xff, 0xff}, nil}, // padding
+		{[]byte{0x02, 0x01, 0x06, 0x05, 0x09, 'a', 'b'}, ErrMalformedAdvertisement},
+		{[]byte{0x02, 0x01}, ErrMalformedAdvertisement},
+	} {
+		var raw rawAdvertisementPayload
+		raw.len = uint8(copy(raw.data[:], tc.data))
+		if err := raw.validate(); err != tc.err {
+			t.Errorf("payload %x: expected %v, got %v", tc.data, tc.err, err)
+		}
+		raw.LocalName() // must not panic
+	}
+
+	// A zero-length field with the type of the requested field must not
+	// panic either.
+	var raw rawAdvertisementPayload
+	raw.len = uint8(copy(raw.data[:], []byte{0x00, 0x09}))
+	if name := raw.LocalName(); name != "" {
+		t.Errorf("expected no name, got %q", name)
+	}
+}
@@ -2,6 +2,7 @@ package bluetooth
 
 import (
 	"fmt"
+	"sync"
 	"unsafe"
 
 	"github.com/go-ole/go-ole"
@@ -37,8 +38,12 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) (err error) {
 	}()
 
 	// Set scanning mode to active so we receive scan responses
-	// from devices in advertising mode
-	err = a.watcher.SetScanningMode(advertisement.BluetoothLEScanningModeActive)
+	// from devices in advertising mode, unless passive scanning was requested.
+	scanningMode := advertisement.BluetoothLEScanningModeActive
+	if a.scanParams.Mode == ScanModePassive {
+		scanningMode = advertisement.BluetoothLEScanningModePassive
+	}
+	err = a.watcher.SetScanningMode(scanningMode)
 	if err != nil {
 		return
 	}
@@ -94,6 +99,8 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) (err error) {
 	if err != nil {
 		return err
 	}
+	a.setScanning(true)
+	defer a.setScanning(false)
 
 	// Wait until advertisement has stopped, and finish.
 	<-stoppingChan
@@ -165,8 +172,22 @@ func (a *Adapter) StopScan() error {
 type Device struct {
 	device  *bluetooth.BluetoothLEDevice
 	session *genericattributeprofile.GattSession
+	adapter *Adapter
+	address Address
+
+	services map[UUID]*DeviceService // services returned by GetService
+
+	// Connection status, updated from the ConnectionStatusChanged event.
+	connectedLock        sync.Mutex
+	connected            bool
+	statusChangedHandler *foundation.TypedEventHandler
+	statusChangedToken   foundation.EventRegistrationToken
 }
 
+// signatureObject is the WinRT signature of System.Object, used as the result
+// type of events that don't pass any arguments.
+const signatureObject = "cinterface(IInspectable)"
+
 // Connect starts a connection attempt to the given peripheral device address.
 //
 // On Linux and Windows, the IsRandom part of the address is ignored.
@@ -229,7 +250,53 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (*Device, er
 		return nil, err
 	}
 
-	return &Device{bleDevice, newSession}, nil
+	device := &Device{
+		device:  bleDevice,
+		session: newSession,
+		adapter: a,
+		address: address,
+	}
+
+	// Watch the connection status, so that a disconnect by the peripheral or a
+	// lost link is noticed. Windows reconnects by itself while the GATT session
+	// is maintained, which is reported as a new connection.
+	// TypedEventHandler<BluetoothLEDevice, Object>
+	guid := winrt.ParameterizedInstanceGUID(foundation.GUIDTypedEventHandler, bluetooth.SignatureBluetoothLEDevice, signatureObject)
+	device.statusChangedHandler = foundation.NewTypedEventHandler(ole.NewGUID(guid), func(_ *foundation.TypedEventHandler, _, _ unsafe.Pointer) {
+		status, err := bleDevice.GetConnectionStatus()
+		if err != nil {
+			return
+		}
+		device.setConnected(status == bluetooth.BluetoothConnectionStatusConnected)
+	})
+	device.statusChangedToken, err = bleDevice.AddConnectionStatusChanged(device.statusChangedHandler)
+	if err != nil {
+		device.statusChangedHandler.Release()
+		_ = newSession.Close()
+		_ = bleDevice.Close()
+		return nil, err
+	}
+
+	device.setConnected(true)
+	return device, nil
+}
+
+// setConnected updates the connection status of the device, and updates the
+// adapter state and calls the connect handler if it changed.
+func (d *Device) setConnected(connected bool) {
+	d.connectedLock.Lock()
+	changed := d.connected != connected
+	d.connected = connected
+	d.connectedLock.Unlock()
+	if !changed {
+		return
+	}
+	if connected {
+		d.adapter.addConnections(1)
+	} else {
+		d.adapter.addConnections(-1)
+	}
+	d.adapter.connectHandler(d.address, connected)
 }
 
 // Disconnect from the BLE device. This method is non-blocking and does not
@@ -238,6 +305,14 @@ func (d *Device) Disconnect() error {
 	defer d.device.Release()
 	defer d.session.Release()
 
+	if d.statusChangedHandler != nil {
+		if err := d.device.RemoveConnectionStatusChanged(d.statusChangedToken); err != nil {
+			return err
+		}
+		d.statusChangedHandler.Release()
+		d.statusChangedHandler = nil
+	}
+
 	if err := d.session.Close(); err != nil {
 		return err
 	}
@@ -245,5 +320,14 @@ func (d *Device) Disconnect() error {
 		return err
 	}
 
+	d.setConnected(false)
 	return nil
 }
+
+// isConnected returns whether the connection is still alive, as last reported
+// by the ConnectionStatusChanged event.
+func (d *Device) isConnected() bool {
+	d.connectedLock.Lock()
+	defer d.connectedLock.Unlock()
+	return d.connected
+}
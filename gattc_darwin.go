@@ -57,6 +57,23 @@ func (d *Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 	}
 }
 
+// GetService returns the service with the given UUID. The service is only
+// discovered the first time it is requested, after that it is returned from a
+// cache in the Device. The cache is cleared by every call to DiscoverServices.
+func (d *Device) GetService(uuid UUID) (*DeviceService, error) {
+	if svc, ok := d.services[uuid]; ok {
+		return &svc, nil
+	}
+	services, err := d.DiscoverServices([]UUID{uuid})
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return &services[0], nil
+}
+
 // uuidWrapper is a type alias for UUID so we ensure no conflicts with
 // struct method of the same name.
 type uuidWrapper = UUID
@@ -200,6 +217,20 @@ func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) err
 	return nil
 }
 
+// Subscribe is like EnableNotifications, but also returns a function that
+// removes the callback and stops the notifications again. CoreBluetooth
+// chooses between notifications and indications.
+func (c DeviceCharacteristic) Subscribe(callback func(buf []byte)) (unsubscribe func() error, err error) {
+	if err := c.EnableNotifications(callback); err != nil {
+		return nil, err
+	}
+	return func() error {
+		c.service.device.prph.SetNotify(false, c.characteristic)
+		c.callback = nil
+		return nil
+	}, nil
+}
+
 // GetMTU returns the MTU for the characteristic.
 func (c DeviceCharacteristic) GetMTU() (uint16, error) {
 	return uint16(c.service.device.prph.MaximumWriteValueLength(false)), nil
@@ -225,3 +256,9 @@ func (c *deviceCharacteristic) Read(data []byte) (n int, err error) {
 	copy(data, c.characteristic.Value())
 	return len(c.characteristic.Value()), nil
 }
+
+// waitWriteBuffer is used by WriteQueue when a write failed. The stack queues
+// write commands itself, so a failed write is not retried.
+func waitWriteBuffer(err error) bool {
+	return false
+}
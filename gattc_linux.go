@@ -4,6 +4,7 @@ package bluetooth
 
 import (
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -36,7 +37,8 @@ func (s *DeviceService) UUID() UUID {
 // DiscoverServices starts a service discovery procedure. Pass a list of service
 // UUIDs you are interested in to this function. Either a slice of all services
 // is returned (of the same length as the requested UUIDs and in the same
-// order), or if some services could not be discovered an error is returned.
+// order), or if some services could not be discovered an error wrapping
+// ErrServiceNotFound is returned.
 //
 // Passing a nil slice of UUIDs will return a complete list of
 // services.
@@ -63,7 +65,6 @@ func (d *Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 
 	services := []DeviceService{}
 	uuidServices := make(map[string]string)
-	servicesFound := 0
 
 	// Iterate through all objects managed by BlueZ, hoping to find the services
 	// we're looking for.
@@ -109,7 +110,7 @@ func (d *Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 
 		if _, ok := uuidServices[service.Properties.UUID]; ok {
 			// There is more than one service with the same UUID?
-			// Don't overwrite it, to keep the servicesFound count correct.
+			// Don't overwrite it.
 			continue
 		}
 
@@ -119,17 +120,55 @@ func (d *Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 		}
 
 		services = append(services, ds)
-		servicesFound++
 		uuidServices[service.Properties.UUID] = service.Properties.UUID
 	}
 
-	if servicesFound < len(uuids) {
-		return nil, errors.New("bluetooth: could not find some services")
+	if err := missingService(uuids, services); err != nil {
+		return nil, err
 	}
 
 	return services, nil
 }
 
+// missingService returns an error wrapping ErrServiceNotFound for the first
+// UUID that is not in the list of discovered services, or nil if all of them
+// were discovered.
+func missingService(uuids []UUID, services []DeviceService) error {
+	for _, uuid := range uuids {
+		found := false
+		for _, service := range services {
+			if service.uuidWrapper == uuid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", ErrServiceNotFound, uuid.String())
+		}
+	}
+	return nil
+}
+
+// GetService returns the service with the given UUID. The service is only
+// discovered the first time it is requested, after that it is returned from a
+// cache in the Device. This keeps memory usage proportional to the services
+// that are actually used instead of discovering all services up front.
+func (d *Device) GetService(uuid UUID) (*DeviceService, error) {
+	if svc, ok := d.services[uuid]; ok {
+		return svc, nil
+	}
+	services, err := d.DiscoverServices([]UUID{uuid})
+	if err != nil {
+		return nil, err
+	}
+	if d.services == nil {
+		d.services = make(map[UUID]*DeviceService)
+	}
+	svc := &services[0]
+	d.services[uuid] = svc
+	return svc, nil
+}
+
 // DeviceCharacteristic is a BLE characteristic on a connected peripheral
 // device.
 type DeviceCharacteristic struct {
@@ -269,7 +308,9 @@ func (c *DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) er
 					continue
 				}
 				if update.Interface == "org.bluez.GattCharacteristic1" && update.Name == "Value" {
-					callback(update.Value.([]byte))
+					if value, ok := update.Value.([]byte); ok {
+						callback(value)
+					}
 				}
 			}
 		}()
@@ -298,6 +339,18 @@ func (c *DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) er
 	}
 }
 
+// Subscribe is like EnableNotifications, but also returns a function that
+// stops the notifications again, like calling EnableNotifications with a nil
+// callback. BlueZ chooses between notifications and indications.
+func (c *DeviceCharacteristic) Subscribe(callback func(buf []byte)) (unsubscribe func() error, err error) {
+	if err := c.EnableNotifications(callback); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return c.EnableNotifications(nil)
+	}, nil
+}
+
 // GetMTU returns the MTU for the characteristic.
 func (c DeviceCharacteristic) GetMTU() (uint16, error) {
 	mtu, err := c.characteristic.GetProperty("MTU")
@@ -317,3 +370,9 @@ func (c *DeviceCharacteristic) Read(data []byte) (int, error) {
 	copy(data, result)
 	return len(result), nil
 }
+
+// waitWriteBuffer is used by WriteQueue when a write failed. The stack queues
+// write commands itself, so a failed write is not retried.
+func waitWriteBuffer(err error) bool {
+	return false
+}
@@ -0,0 +1,26 @@
+//go:build linux && !baremetal
+
+package bluetooth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMissingService(t *testing.T) {
+	services := []DeviceService{
+		{uuidWrapper: ServiceUUIDHeartRate},
+		{uuidWrapper: ServiceUUIDBattery},
+	}
+
+	if err := missingService(nil, services); err != nil {
+		t.Errorf("expected no error without a filter, got %v", err)
+	}
+	if err := missingService([]UUID{ServiceUUIDBattery, ServiceUUIDHeartRate}, services); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	err := missingService([]UUID{ServiceUUIDHeartRate, ServiceUUIDDeviceInformation}, services)
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+//go:build !baremetal || (softdevice && s132v6) || (softdevice && s140v6) || (softdevice && s140v7)
+
+package bluetooth
+
+import "sync"
+
+// WriteQueue writes values to a characteristic using write commands (write
+// without response), in the background. When new values are queued faster
+// than they can be sent, only the most recent value is kept: older pending
+// values are dropped. This is useful for characteristics that represent a
+// state that is updated frequently, like the color of a LED, where only the
+// latest value matters.
+//
+// Memory usage is bounded: only a single pending value is stored. When the
+// Bluetooth stack is temporarily out of buffers (on Nordic SoftDevices), the
+// value is retried once a previous write command has been sent, unless a newer
+// value has been queued in the meantime.
+type WriteQueue struct {
+	write func([]byte) (int, error)
+
+	// wait is called when a write failed. If the stack was temporarily out of
+	// buffers, it waits until there may be space again and returns true, so
+	// that the write is retried. Otherwise, it returns false.
+	wait func(err error) bool
+
+	lock    sync.Mutex
+	pending []byte
+	queued  bool  // whether pending contains a value that hasn't been sent
+	running bool  // whether a goroutine is currently sending values
+	err     error // last error while sending a value
+	done    chan struct{}
+}
+
+// NewWriteQueue returns a new write queue that writes to the given
+// characteristic.
+func NewWriteQueue(c DeviceCharacteristic) *WriteQueue {
+	return &WriteQueue{
+		write: c.WriteWithoutResponse,
+		wait:  waitWriteBuffer,
+	}
+}
+
+// Write queues a new value to be written to the characteristic, replacing any
+// value that is queued but not yet sent. The data is copied, so p may be
+// reused after Write returns.
+//
+// Writes happen in the background, so errors are reported on the next call to
+// Write or Flush.
+func (q *WriteQueue) Write(p []byte) (n int, err error) {
+	q.lock.Lock()
+	err = q.err
+	q.err = nil
+	q.pending = append(q.pending[:0], p...)
+	q.queued = true
+	if !q.running {
+		q.running = true
+		q.done = make(chan struct{})
+		go q.run()
+	}
+	q.lock.Unlock()
+	return len(p), err
+}
+
+// Flush waits until all queued values have been sent and returns the last
+// error that happened while sending them, if any.
+func (q *WriteQueue) Flush() error {
+	q.lock.Lock()
+	done := q.done
+	q.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+	q.lock.Lock()
+	err := q.err
+	q.err = nil
+	q.lock.Unlock()
+	return err
+}
+
+// run sends queued values until there are none left.
+func (q *WriteQueue) run() {
+	var buf []byte
+	for {
+		q.lock.Lock()
+		if !q.queued {
+			q.running = false
+			close(q.done)
+			q.done = nil
+			q.lock.Unlock()
+			return
+		}
+		// Swap the buffers, so that new values can be queued while this one
+		// is being sent.
+		buf, q.pending = q.pending, buf[:0]
+		q.queued = false
+		q.lock.Unlock()
+
+		q.send(buf)
+	}
+}
+
+// send writes a single value, retrying while the stack is out of buffers and
+// no newer value has been queued.
+func (q *WriteQueue) send(buf []byte) {
+	for {
+		_, err := q.write(buf)
+		if err == nil {
+			return
+		}
+		if !q.wait(err) {
+			q.lock.Lock()
+			q.err = err
+			q.lock.Unlock()
+			return
+		}
+		q.lock.Lock()
+		newer := q.queued
+		q.lock.Unlock()
+		if newer {
+			// Don't bother retrying, the newer value replaces this one.
+			return
+		}
+	}
+}
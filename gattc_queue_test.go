@@ -0,0 +1,118 @@
+package bluetooth
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeWriter records the values written by a WriteQueue. Each write blocks
+// until it is released, so that the test controls when writes complete.
+type fakeWriter struct {
+	values  chan string
+	release chan error
+}
+
+func newFakeWriter() *fakeWriter {
+	return &fakeWriter{
+		values:  make(chan string, 10),
+		release: make(chan error),
+	}
+}
+
+func (w *fakeWriter) write(p []byte) (int, error) {
+	w.values <- string(p)
+	if err := <-w.release; err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestWriteQueueLatestValueWins(t *testing.T) {
+	writer := newFakeWriter()
+	q := &WriteQueue{write: writer.write, wait: func(error) bool { return false }}
+
+	// The first value is sent right away, the next ones replace each other
+	// while it is being written.
+	q.Write([]byte("a"))
+	if value := <-writer.values; value != "a" {
+		t.Fatalf("expected a, got %s", value)
+	}
+	q.Write([]byte("b"))
+	buf := []byte("c")
+	q.Write(buf)
+	buf[0] = 'x' // the queue must have made a copy
+	writer.release <- nil
+	if value := <-writer.values; value != "c" {
+		t.Fatalf("expected c, got %s", value)
+	}
+	writer.release <- nil
+	if err := q.Flush(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(writer.values) != 0 {
+		t.Errorf("unexpected extra write: %s", <-writer.values)
+	}
+}
+
+func TestWriteQueueError(t *testing.T) {
+	writer := newFakeWriter()
+	q := &WriteQueue{write: writer.write, wait: func(error) bool { return false }}
+	errWrite := errors.New("write failed")
+
+	q.Write([]byte("a"))
+	<-writer.values
+	writer.release <- errWrite
+	if err := q.Flush(); err != errWrite {
+		t.Errorf("expected the write error from Flush, got %v", err)
+	}
+	if err := q.Flush(); err != nil {
+		t.Errorf("expected the error to be reported only once, got %v", err)
+	}
+}
+
+func TestWriteQueueRetry(t *testing.T) {
+	writer := newFakeWriter()
+	errBusy := errors.New("out of buffers")
+	waiting := make(chan struct{})
+	resume := make(chan struct{})
+	q := &WriteQueue{write: writer.write, wait: func(err error) bool {
+		if err != errBusy {
+			return false
+		}
+		waiting <- struct{}{}
+		<-resume
+		return true
+	}}
+
+	// A value that couldn't be sent because the stack was busy is retried.
+	q.Write([]byte("a"))
+	<-writer.values
+	writer.release <- errBusy
+	<-waiting
+	resume <- struct{}{}
+	if value := <-writer.values; value != "a" {
+		t.Fatalf("expected a to be retried, got %s", value)
+	}
+	writer.release <- nil
+	if err := q.Flush(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// But not when a newer value was queued in the meantime.
+	q.Write([]byte("b"))
+	<-writer.values
+	writer.release <- errBusy
+	<-waiting
+	q.Write([]byte("c"))
+	resume <- struct{}{}
+	if value := <-writer.values; value != "c" {
+		t.Fatalf("expected c to replace b, got %s", value)
+	}
+	writer.release <- nil
+	if err := q.Flush(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(writer.values) != 0 {
+		t.Errorf("unexpected extra write: %s", <-writer.values)
+	}
+}
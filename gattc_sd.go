@@ -3,6 +3,7 @@
 package bluetooth
 
 /*
+#include "nrf_error.h"
 #include "ble_gattc.h"
 */
 import "C"
@@ -11,6 +12,7 @@ import (
 	"device/arm"
 	"errors"
 	"runtime/volatile"
+	"time"
 )
 
 const (
@@ -51,7 +53,8 @@ func (s *DeviceService) UUID() UUID {
 // DiscoverServices starts a service discovery procedure. Pass a list of service
 // UUIDs you are interested in to this function. Either a slice of all services
 // is returned (of the same length as the requested UUIDs and in the same
-// order), or if some services could not be discovered an error is returned.
+// order), or if some services could not be discovered ErrServiceNotFound is
+// returned.
 //
 // Passing a nil slice of UUIDs will return a complete list of
 // services.
@@ -125,7 +128,7 @@ func (d *Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 		if startHandle == 0 {
 			// The event handler will set the start handle to zero if the
 			// service was not found.
-			return nil, errNotFound
+			return nil, ErrServiceNotFound
 		}
 
 		// Store the discovered service.
@@ -154,6 +157,26 @@ func (d *Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 	return services, nil
 }
 
+// GetService returns the service with the given UUID. The service is only
+// discovered the first time it is requested, after that it is returned from a
+// cache in the Device. This keeps memory usage proportional to the services
+// that are actually used instead of discovering all services up front.
+func (d *Device) GetService(uuid UUID) (*DeviceService, error) {
+	if svc, ok := d.services[uuid]; ok {
+		return svc, nil
+	}
+	services, err := d.DiscoverServices([]UUID{uuid})
+	if err != nil {
+		return nil, err
+	}
+	if d.services == nil {
+		d.services = make(map[UUID]*DeviceService)
+	}
+	svc := &services[0]
+	d.services[uuid] = svc
+	return svc, nil
+}
+
 // DeviceCharacteristic is a BLE characteristic on a connected peripheral
 // device. It is only valid as long as the device remains connected.
 type DeviceCharacteristic struct {
@@ -276,9 +299,9 @@ func (s *DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacter
 		dc.permissions = permissions
 		dc.valueHandle = foundCharacteristicHandle
 
-		if permissions&CharacteristicNotifyPermission != 0 {
-			// This characteristic has the notify permission, so most
-			// likely it also supports notifications.
+		if permissions&(CharacteristicNotifyPermission|CharacteristicIndicatePermission) != 0 {
+			// This characteristic has the notify or indicate permission, so
+			// most likely it also has a CCCD.
 			errCode := C.sd_ble_gattc_descriptors_discover(s.connectionHandle, &C.ble_gattc_handle_range_t{
 				start_handle: startHandle,
 				end_handle:   startHandle + 1,
@@ -320,6 +343,9 @@ func (c DeviceCharacteristic) WriteWithoutResponse(p []byte) (n int, err error)
 		return 0, nil
 	}
 
+	// Only a write command sent after this point frees a buffer for a retry
+	// by waitWriteBuffer.
+	gattcWriteCmdTxComplete.Set(0)
 	errCode := C.sd_ble_gattc_write(c.connectionHandle, &C.ble_gattc_write_params_t{
 		write_op: C.BLE_GATT_OP_WRITE_CMD,
 		handle:   c.valueHandle,
@@ -333,6 +359,33 @@ func (c DeviceCharacteristic) WriteWithoutResponse(p []byte) (n int, err error)
 	return len(p), nil
 }
 
+// Set by the event handler when a write command has been sent, which frees a
+// buffer for the next one. It is cleared before every write command.
+var gattcWriteCmdTxComplete volatile.Register8
+
+// How long waitWriteBuffer waits for a buffer before giving up, for example
+// because the connection was lost.
+const writeBufferTimeout = time.Second
+
+// waitWriteBuffer is used by WriteQueue when a write failed. If the SoftDevice
+// was out of buffers for write commands, it waits until one of them has been
+// sent and returns true, so that the write is retried.
+func waitWriteBuffer(err error) bool {
+	if err != Error(C.NRF_ERROR_RESOURCES) {
+		return false
+	}
+	start := time.Now()
+	for gattcWriteCmdTxComplete.Get() == 0 {
+		if time.Since(start) > writeBufferTimeout {
+			return false
+		}
+		// Sleep instead of waiting for an event, so that other goroutines can
+		// run: WriteQueue calls this from a background goroutine.
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
 type gattcNotificationCallback struct {
 	connectionHandle uint16
 	valueHandle      uint16 // may be 0 if the slot is empty
@@ -347,13 +400,14 @@ var gattcNotificationCallbacks []gattcNotificationCallback
 // EnableNotifications enables notifications in the Client Characteristic
 // Configuration Descriptor (CCCD). This means that most peripherals will send a
 // notification with a new value every time the value of the characteristic
-// changes.
+// changes. If the characteristic only supports indications, indications are
+// enabled instead; they are confirmed automatically.
 //
 // Warning: when using the SoftDevice, the callback is called from an interrupt
 // which means there are various limitations (such as not being able to allocate
 // heap memory).
 func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) error {
-	if c.permissions&CharacteristicNotifyPermission == 0 {
+	if c.permissions&(CharacteristicNotifyPermission|CharacteristicIndicatePermission) == 0 {
 		return errNoNotify
 	}
 
@@ -399,14 +453,43 @@ func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) err
 		RestoreInterrupts(mask)
 	}
 
-	// Write to the CCCD to enable notifications. Don't wait for a response.
-	value := [2]byte{0x01, 0x00} // 0x0001 enables notifications (and disables indications)
+	// Write to the CCCD to enable notifications.
+	var value uint8 = 0x01 // 0x0001 enables notifications (and disables indications)
+	if c.permissions&CharacteristicNotifyPermission == 0 {
+		value = 0x02 // 0x0002 enables indications
+	}
+	return c.writeCCCD(value)
+}
+
+// Subscribe is like EnableNotifications, but also returns a function that
+// removes the callback and disables notifications (or indications) again in
+// the CCCD.
+func (c DeviceCharacteristic) Subscribe(callback func(buf []byte)) (unsubscribe func() error, err error) {
+	if err := c.EnableNotifications(callback); err != nil {
+		return nil, err
+	}
+	return func() error {
+		mask := DisableInterrupts()
+		for i, callbackInfo := range gattcNotificationCallbacks {
+			if callbackInfo.connectionHandle == c.connectionHandle && callbackInfo.valueHandle == c.valueHandle {
+				gattcNotificationCallbacks[i].valueHandle = 0 // 0 means invalid
+			}
+		}
+		RestoreInterrupts(mask)
+		return c.writeCCCD(0x00)
+	}, nil
+}
+
+// writeCCCD writes the Client Characteristic Configuration Descriptor. It
+// doesn't wait for a response.
+func (c DeviceCharacteristic) writeCCCD(value uint8) error {
+	buf := [2]byte{value, 0x00}
 	errCode := C.sd_ble_gattc_write(c.connectionHandle, &C.ble_gattc_write_params_t{
 		write_op: C.BLE_GATT_OP_WRITE_CMD,
 		handle:   c.cccdHandle,
 		offset:   0,
 		len:      2,
-		p_value:  &value[0],
+		p_value:  &buf[0],
 	})
 	return makeError(errCode)
 }
@@ -107,6 +107,29 @@ func (d *Device) DiscoverServices(filterUUIDs []UUID) ([]DeviceService, error) {
 	return services, nil
 }
 
+// GetService returns the service with the given UUID. The service is only
+// discovered the first time it is requested, after that it is returned from a
+// cache in the Device. This keeps memory usage proportional to the services
+// that are actually used instead of discovering all services up front.
+func (d *Device) GetService(uuid UUID) (*DeviceService, error) {
+	if svc, ok := d.services[uuid]; ok {
+		return svc, nil
+	}
+	services, err := d.DiscoverServices([]UUID{uuid})
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, ErrServiceNotFound
+	}
+	if d.services == nil {
+		d.services = make(map[UUID]*DeviceService)
+	}
+	svc := &services[0]
+	d.services[uuid] = svc
+	return svc, nil
+}
+
 func winRTUuidToUuid(uuid syscall.GUID) UUID {
 	return NewUUID([16]byte{
 		byte(uuid.Data1 >> 24),
@@ -365,9 +388,32 @@ func (c *DeviceCharacteristic) Read(data []byte) (int, error) {
 // notification with a new value every time the value of the characteristic
 // changes.
 func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) error {
+	_, err := c.enableNotifications(callback)
+	return err
+}
+
+// Subscribe is like EnableNotifications, but also returns a function that
+// removes the callback and disables notifications (or indications) again.
+func (c DeviceCharacteristic) Subscribe(callback func(buf []byte)) (unsubscribe func() error, err error) {
+	token, err := c.enableNotifications(callback)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		if err := c.characteristic.RemoveValueChanged(token); err != nil {
+			return err
+		}
+		return c.writeCCCD(genericattributeprofile.GattClientCharacteristicConfigurationDescriptorValueNone)
+	}, nil
+}
+
+// enableNotifications implements EnableNotifications. It returns the token of
+// the registered callback, so that it can be removed again.
+func (c DeviceCharacteristic) enableNotifications(callback func(buf []byte)) (foundation.EventRegistrationToken, error) {
+	var token foundation.EventRegistrationToken
 	if (c.properties&genericattributeprofile.GattCharacteristicPropertiesNotify == 0) &&
 	   (c.properties&genericattributeprofile.GattCharacteristicPropertiesIndicate == 0) {
-		return errNoNotify
+		return token, errNoNotify
 	}
 
 	// listen value changed event
@@ -399,17 +445,22 @@ func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) err
 
 		callback(data)
 	})
-	_, err := c.characteristic.AddValueChanged(valueChangedEventHandler)
+	token, err := c.characteristic.AddValueChanged(valueChangedEventHandler)
 	if err != nil {
-		return err
+		return token, err
 	}
 
-	var writeOp *foundation.IAsyncOperation
-	if c.properties&genericattributeprofile.GattCharacteristicPropertiesNotify != 0 {
-		writeOp, err = c.characteristic.WriteClientCharacteristicConfigurationDescriptorAsync(genericattributeprofile.GattClientCharacteristicConfigurationDescriptorValueNotify)
-	} else {
-		writeOp, err = c.characteristic.WriteClientCharacteristicConfigurationDescriptorAsync(genericattributeprofile.GattClientCharacteristicConfigurationDescriptorValueIndicate)
+	value := genericattributeprofile.GattClientCharacteristicConfigurationDescriptorValueNotify
+	if c.properties&genericattributeprofile.GattCharacteristicPropertiesNotify == 0 {
+		value = genericattributeprofile.GattClientCharacteristicConfigurationDescriptorValueIndicate
 	}
+	return token, c.writeCCCD(value)
+}
+
+// writeCCCD writes the Client Characteristic Configuration Descriptor and
+// waits for the result.
+func (c DeviceCharacteristic) writeCCCD(value genericattributeprofile.GattClientCharacteristicConfigurationDescriptorValue) error {
+	writeOp, err := c.characteristic.WriteClientCharacteristicConfigurationDescriptorAsync(value)
 	if err != nil {
 		return err
 	}
@@ -432,3 +483,9 @@ func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) err
 
 	return nil
 }
+
+// waitWriteBuffer is used by WriteQueue when a write failed. The stack queues
+// write commands itself, so a failed write is not retried.
+func waitWriteBuffer(err error) bool {
+	return false
+}
@@ -18,6 +18,68 @@ type CharacteristicConfig struct {
 	Value      []byte
 	Flags      CharacteristicPermissions
 	WriteEvent func(client Connection, offset int, value []byte)
+
+	// Description is a human readable name for the characteristic, stored in
+	// a Characteristic User Description descriptor. It is omitted if empty.
+	Description string
+
+	// PresentationFormat describes the format and unit of the value, stored
+	// in a Characteristic Presentation Format descriptor. It is omitted if
+	// nil.
+	PresentationFormat *PresentationFormat
+
+	// AggregateFormat describes a value that consists of several fields, one
+	// presentation format per field in order. A presentation format
+	// descriptor is added for each field, together with a Characteristic
+	// Aggregate Format descriptor that lists them. It can't be combined with
+	// PresentationFormat.
+	AggregateFormat []PresentationFormat
+
+	// NotifyOnSubscribe sends the current value as a notification (or
+	// indication) as soon as a client subscribes to the characteristic, so
+	// that it doesn't have to wait for the next change or read the value
+	// separately. The value is only sent after the subscription has been
+	// stored, so that it can't get lost.
+	//
+	// It is only supported on Nordic SoftDevices and ignored elsewhere.
+	NotifyOnSubscribe bool
+}
+
+// PresentationFormat describes how the value of a characteristic should be
+// interpreted and displayed, for example as a signed 16-bit integer in degrees
+// Celsius with two decimal places. See the Bluetooth Assigned Numbers document
+// for a list of formats and units.
+type PresentationFormat struct {
+	Format      uint8  // format of the value, such as PresentationFormatSint16
+	Exponent    int8   // the value is multiplied by 10^Exponent
+	Unit        uint16 // unit UUID, such as 0x272F for degrees Celsius
+	Namespace   uint8  // 1 for the Bluetooth SIG namespace
+	Description uint16 // description within the namespace, 0 if unknown
+}
+
+// Some common formats for PresentationFormat.Format.
+const (
+	PresentationFormatBoolean = 0x01
+	PresentationFormatUint8   = 0x04
+	PresentationFormatUint16  = 0x06
+	PresentationFormatUint32  = 0x08
+	PresentationFormatSint8   = 0x0C
+	PresentationFormatSint16  = 0x0E
+	PresentationFormatSint32  = 0x10
+	PresentationFormatFloat32 = 0x14
+	PresentationFormatUTF8    = 0x19
+)
+
+// Bytes returns the 7-byte value of the Characteristic Presentation Format
+// descriptor.
+func (f *PresentationFormat) Bytes() []byte {
+	return []byte{
+		f.Format,
+		byte(f.Exponent),
+		byte(f.Unit), byte(f.Unit >> 8),
+		f.Namespace,
+		byte(f.Description), byte(f.Description >> 8),
+	}
 }
 
 // CharacteristicPermissions lists a number of basic permissions/capabilities
@@ -56,3 +118,13 @@ func (p CharacteristicPermissions) Write() bool {
 func (p CharacteristicPermissions) WriteWithoutResponse() bool {
 	return p&CharacteristicWriteWithoutResponsePermission != 0
 }
+
+// Notify returns whether notifications of the value are permitted.
+func (p CharacteristicPermissions) Notify() bool {
+	return p&CharacteristicNotifyPermission != 0
+}
+
+// Indicate returns whether indications of the value are permitted.
+func (p CharacteristicPermissions) Indicate() bool {
+	return p&CharacteristicIndicatePermission != 0
+}
@@ -0,0 +1,104 @@
+package bluetooth
+
+import "strconv"
+
+// describeGATT returns a JSON description of the given services, for
+// Adapter.GATTDescription. The format looks like this, where description and
+// format are omitted when the characteristic doesn't have them:
+//
+//	{"services":[{"uuid":"0000180d-0000-1000-8000-00805f9b34fb","characteristics":[
+//		{"uuid":"00002a37-0000-1000-8000-00805f9b34fb","properties":["read","notify"],
+//		 "description":"Heart rate","format":{"format":4,"exponent":0,"unit":10159,"namespace":1,"description":0}}]}]}
+//
+// It doesn't use encoding/json, to keep the binary size down on
+// microcontrollers.
+func describeGATT(services []*Service) []byte {
+	buf := []byte(`{"services":[`)
+	for i, service := range services {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, `{"uuid":`...)
+		buf = appendJSONString(buf, service.UUID.String())
+		buf = append(buf, `,"characteristics":[`...)
+		for j, char := range service.Characteristics {
+			if j != 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, `{"uuid":`...)
+			buf = appendJSONString(buf, char.UUID.String())
+			buf = append(buf, `,"properties":[`...)
+			first := true
+			for _, property := range characteristicPropertyNames {
+				if char.Flags&property.flag == 0 {
+					continue
+				}
+				if !first {
+					buf = append(buf, ',')
+				}
+				first = false
+				buf = appendJSONString(buf, property.name)
+			}
+			buf = append(buf, ']')
+			if char.Description != "" {
+				buf = append(buf, `,"description":`...)
+				buf = appendJSONString(buf, char.Description)
+			}
+			if char.PresentationFormat != nil {
+				buf = append(buf, `,"format":`...)
+				buf = appendPresentationFormatJSON(buf, char.PresentationFormat)
+			}
+			buf = append(buf, '}')
+		}
+		buf = append(buf, "]}"...)
+	}
+	return append(buf, "]}"...)
+}
+
+// Names of the characteristic properties in the GATT description, in the order
+// of the property bits.
+var characteristicPropertyNames = [...]struct {
+	flag CharacteristicPermissions
+	name string
+}{
+	{CharacteristicBroadcastPermission, "broadcast"},
+	{CharacteristicReadPermission, "read"},
+	{CharacteristicWriteWithoutResponsePermission, "write-without-response"},
+	{CharacteristicWritePermission, "write"},
+	{CharacteristicNotifyPermission, "notify"},
+	{CharacteristicIndicatePermission, "indicate"},
+}
+
+// appendPresentationFormatJSON appends the presentation format as a JSON
+// object.
+func appendPresentationFormatJSON(buf []byte, f *PresentationFormat) []byte {
+	buf = append(buf, `{"format":`...)
+	buf = strconv.AppendUint(buf, uint64(f.Format), 10)
+	buf = append(buf, `,"exponent":`...)
+	buf = strconv.AppendInt(buf, int64(f.Exponent), 10)
+	buf = append(buf, `,"unit":`...)
+	buf = strconv.AppendUint(buf, uint64(f.Unit), 10)
+	buf = append(buf, `,"namespace":`...)
+	buf = strconv.AppendUint(buf, uint64(f.Namespace), 10)
+	buf = append(buf, `,"description":`...)
+	buf = strconv.AppendUint(buf, uint64(f.Description), 10)
+	return append(buf, '}')
+}
+
+// appendJSONString appends s as a quoted JSON string.
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"')
+}
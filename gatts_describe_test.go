@@ -0,0 +1,33 @@
+package bluetooth
+
+import "testing"
+
+func TestDescribeGATT(t *testing.T) {
+	services := []*Service{
+		{
+			UUID: ServiceUUIDHeartRate,
+			Characteristics: []CharacteristicConfig{
+				{
+					UUID:        CharacteristicUUIDHeartRateMeasurement,
+					Flags:       CharacteristicReadPermission | CharacteristicNotifyPermission,
+					Description: "Heart \"rate\"\n",
+					PresentationFormat: &PresentationFormat{
+						Format:    PresentationFormatUint8,
+						Unit:      0x27af,
+						Namespace: 1,
+					},
+				},
+			},
+		},
+		{UUID: ServiceUUIDBattery},
+	}
+	expected := `{"services":[` +
+		`{"uuid":"0000180d-0000-1000-8000-00805f9b34fb","characteristics":[` +
+		`{"uuid":"00002a37-0000-1000-8000-00805f9b34fb","properties":["read","notify"],` +
+		`"description":"Heart \"rate\"\u000a",` +
+		`"format":{"format":4,"exponent":0,"unit":10159,"namespace":1,"description":0}}]},` +
+		`{"uuid":"0000180f-0000-1000-8000-00805f9b34fb","characteristics":[]}]}`
+	if description := string(describeGATT(services)); description != expected {
+		t.Errorf("unexpected description:\nexpected: %s\nactual:   %s", expected, description)
+	}
+}
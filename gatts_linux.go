@@ -3,10 +3,14 @@
 package bluetooth
 
 import (
+	"errors"
+
 	"github.com/muka/go-bluetooth/api/service"
 	"github.com/muka/go-bluetooth/bluez/profile/gatt"
 )
 
+var errAggregateFormatNotSupported = errors.New("bluetooth: aggregate format descriptors are not supported by BlueZ")
+
 // Characteristic is a single characteristic in a service. It has an UUID and a
 // value.
 type Characteristic struct {
@@ -42,6 +46,12 @@ func (a *Adapter) AddService(s *Service) error {
 	}
 
 	for _, char := range s.Characteristics {
+		if len(char.AggregateFormat) != 0 {
+			// The aggregate format descriptor contains attribute handles,
+			// which are assigned by BlueZ and not known here.
+			return errAggregateFormatNotSupported
+		}
+
 		// Create characteristic handle.
 		bluezChar, err := bluezService.NewChar(char.UUID.String())
 		if err != nil {
@@ -88,9 +98,49 @@ func (a *Adapter) AddService(s *Service) error {
 		if err != nil {
 			return err
 		}
+
+		// Add the optional descriptors, which are read-only.
+		if char.Description != "" {
+			err = addDescriptor(bluezChar, 0x2901, []byte(char.Description))
+			if err != nil {
+				return err
+			}
+		}
+		if char.PresentationFormat != nil {
+			err = addDescriptor(bluezChar, 0x2904, char.PresentationFormat.Bytes())
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	return app.Run()
+	err = app.Run()
+	if err != nil {
+		return err
+	}
+	a.services = append(a.services, s)
+	return nil
+}
+
+// GATTDescription returns a machine-readable (JSON) description of the
+// services added with AddService: their UUIDs and the UUIDs, properties,
+// descriptions and presentation formats of their characteristics. This is
+// meant for tooling, for example to generate client code for a mobile app from
+// the service definitions in the firmware.
+func (a *Adapter) GATTDescription() []byte {
+	return describeGATT(a.services)
+}
+
+// addDescriptor adds a read-only descriptor with a fixed value to the
+// characteristic.
+func addDescriptor(bluezChar *service.Char, uuid uint16, value []byte) error {
+	bluezDescr, err := bluezChar.NewDescr(New16BitUUID(uuid).String())
+	if err != nil {
+		return err
+	}
+	bluezDescr.Properties.Flags = []string{gatt.FlagDescriptorRead}
+	bluezDescr.Properties.Value = value
+	return bluezChar.AddDescr(bluezDescr)
 }
 
 // Write replaces the characteristic value with a new value.
@@ -105,3 +155,11 @@ func (c *Characteristic) Write(p []byte) (n int, err error) {
 	}
 	return len(p), nil
 }
+
+// notify updates the value, which BlueZ sends as a notification to subscribed
+// clients. BlueZ doesn't report whether any client is subscribed, so the
+// notification is assumed to have been sent.
+func (c *Characteristic) notify(p []byte) (sent bool, err error) {
+	_, err = c.Write(p)
+	return err == nil, err
+}
@@ -18,6 +18,26 @@ static inline uint32_t sd_ble_gatts_value_set_noescape(uint16_t conn_handle, uin
 */
 import "C"
 
+import (
+	"errors"
+	"math"
+	"runtime/volatile"
+	"time"
+)
+
+var errPresentationAndAggregateFormat = errors.New("bluetooth: a characteristic can't have both a presentation format and an aggregate format")
+
+// Incremented on every GATT server event and every sent notification, to
+// detect idle connections.
+var gattsActivity volatile.Register32
+
+// State for SetIdleTimeout: the timeout in milliseconds (0 if disabled), and
+// whether idleLoop is running.
+var (
+	idleTimeoutMillis volatile.Register32
+	idleLoopRunning   volatile.Register8
+)
+
 // Characteristic is a single characteristic in a service. It has an UUID and a
 // value.
 type Characteristic struct {
@@ -28,6 +48,13 @@ type Characteristic struct {
 // AddService creates a new service with the characteristics listed in the
 // Service struct.
 func (a *Adapter) AddService(service *Service) error {
+	for _, char := range service.Characteristics {
+		if char.PresentationFormat != nil && len(char.AggregateFormat) != 0 {
+			// The aggregate format would only list its own fields, leaving
+			// the extra presentation format descriptor unexplained.
+			return errPresentationAndAggregateFormat
+		}
+	}
 	uuid, errCode := service.UUID.shortUUID()
 	if errCode != 0 {
 		return Error(errCode)
@@ -44,6 +71,21 @@ func (a *Adapter) AddService(service *Service) error {
 		metadata.char_props.set_bitfield_write(uint8(char.Flags>>3) & 1)
 		metadata.char_props.set_bitfield_notify(uint8(char.Flags>>4) & 1)
 		metadata.char_props.set_bitfield_indicate(uint8(char.Flags>>5) & 1)
+		if char.Description != "" {
+			description := []byte(char.Description)
+			metadata.p_char_user_desc = &description[0]
+			metadata.char_user_desc_size = uint16(len(description))
+			metadata.char_user_desc_max_size = uint16(len(description))
+		}
+		if char.PresentationFormat != nil {
+			metadata.p_char_pf = &C.ble_gatts_char_pf_t{
+				format:     char.PresentationFormat.Format,
+				exponent:   char.PresentationFormat.Exponent,
+				unit:       char.PresentationFormat.Unit,
+				name_space: char.PresentationFormat.Namespace,
+				desc:       char.PresentationFormat.Description,
+			}
+		}
 		handles := C.ble_gatts_char_handles_t{}
 		charUUID, errCode := char.UUID.shortUUID()
 		if errCode != 0 {
@@ -68,6 +110,22 @@ func (a *Adapter) AddService(service *Service) error {
 		if errCode != 0 {
 			return Error(errCode)
 		}
+		if len(char.AggregateFormat) != 0 {
+			// Add a presentation format descriptor for each field, and then
+			// the aggregate format descriptor listing their handles.
+			aggregate := make([]byte, 0, len(char.AggregateFormat)*2)
+			for i := range char.AggregateFormat {
+				handle, err := addDescriptor(0x2904, char.AggregateFormat[i].Bytes())
+				if err != nil {
+					return err
+				}
+				aggregate = append(aggregate, byte(handle), byte(handle>>8))
+			}
+			_, err := addDescriptor(0x2905, aggregate)
+			if err != nil {
+				return err
+			}
+		}
 		if char.Handle != nil {
 			char.Handle.handle = handles.value_handle
 			char.Handle.permissions = char.Flags
@@ -81,8 +139,69 @@ func (a *Adapter) AddService(service *Service) error {
 			a.charWriteHandlers = handlers
 			RestoreInterrupts(mask)
 		}
+		if char.NotifyOnSubscribe && (char.Flags.Notify() || char.Flags.Indicate()) {
+			// Watch writes to the CCCD. The write event is only sent after
+			// the SoftDevice has stored the new CCCD value, so sending the
+			// current value (p_data is nil) from the event is allowed.
+			valueHandle := handles.value_handle
+			handlers := append(a.charWriteHandlers, charWriteHandler{
+				handle: handles.cccd_handle,
+				callback: func(connection Connection, offset int, value []byte) {
+					if len(value) == 0 {
+						return
+					}
+					if value[0]&0x01 != 0 { // notifications enabled
+						C.sd_ble_gatts_hvx_noescape(uint16(connection), valueHandle, C.BLE_GATT_HVX_NOTIFICATION, 0, 0, nil)
+					} else if value[0]&0x02 != 0 { // indications enabled
+						C.sd_ble_gatts_hvx_noescape(uint16(connection), valueHandle, C.BLE_GATT_HVX_INDICATION, 0, 0, nil)
+					}
+				},
+			})
+			mask := DisableInterrupts()
+			a.charWriteHandlers = handlers
+			RestoreInterrupts(mask)
+		}
+	}
+	if errCode != 0 {
+		return Error(errCode)
 	}
-	return makeError(errCode)
+	a.services = append(a.services, service)
+	return nil
+}
+
+// GATTDescription returns a machine-readable (JSON) description of the
+// services added with AddService: their UUIDs and the UUIDs, properties,
+// descriptions and presentation formats of their characteristics. This is
+// meant for tooling, for example to generate client code for a mobile app from
+// the service definitions in the firmware.
+func (a *Adapter) GATTDescription() []byte {
+	return describeGATT(a.services)
+}
+
+// addDescriptor adds a read-only descriptor with a fixed value to the
+// characteristic that was added last, and returns its handle.
+func addDescriptor(uuid uint16, value []byte) (uint16, error) {
+	descUUID := C.ble_uuid_t{
+		uuid:  uuid,
+		_type: C.BLE_UUID_TYPE_BLE,
+	}
+	attr := C.ble_gatts_attr_t{
+		p_uuid: &descUUID,
+		p_attr_md: &C.ble_gatts_attr_md_t{
+			read_perm: secModeOpen,
+			// write_perm is left at zero, which means no access.
+		},
+		init_len: uint16(len(value)),
+		max_len:  uint16(len(value)),
+		p_value:  &value[0],
+	}
+	attr.p_attr_md.set_bitfield_vloc(C.BLE_GATTS_VLOC_STACK)
+	var handle uint16
+	errCode := C.sd_ble_gatts_descriptor_add(C.BLE_GATT_HANDLE_INVALID, &attr, &handle)
+	if errCode != 0 {
+		return 0, Error(errCode)
+	}
+	return handle, nil
 }
 
 // charWriteHandler contains a handler->callback mapping for characteristic
@@ -116,34 +235,13 @@ func (c *Characteristic) Write(p []byte) (n int, err error) {
 		return 0, nil
 	}
 
-	connHandle := currentConnection.Get()
-	if connHandle != C.BLE_CONN_HANDLE_INVALID {
-		// There is a connected central.
-		p_len := uint16(len(p))
-		errCode := C.sd_ble_gatts_hvx_noescape(connHandle,
-			c.handle,
-			C.BLE_GATT_HVX_NOTIFICATION,
-			0,
-			p_len,
-			&p[0],
-		)
-
-		// Check for some expected errors. Don't report them as errors, but
-		// instead fall through and do a normal characteristic value update.
-		// Only return (and possibly report an error) in other cases.
-		//
-		// TODO: improve CGo so that the C constant can be used.
-		if errCode == 0x0008 { // C.NRF_ERROR_INVALID_STATE
-			// May happen when the central has unsubscribed from the
-			// characteristic.
-		} else if errCode == 0x3401 { // C.BLE_ERROR_GATTS_SYS_ATTR_MISSING
-			// May happen when the central is not subscribed to this
-			// characteristic.
-		} else {
-			return int(p_len), makeError(errCode)
-		}
+	// Try to send a notification first. This also updates the value.
+	sent, err := c.notify(p)
+	if sent || err != nil {
+		return len(p), err
 	}
 
+	// Nobody was notified, so update the value directly.
 	errCode := C.sd_ble_gatts_value_set_noescape(C.BLE_CONN_HANDLE_INVALID, c.handle, C.ble_gatts_value_t{
 		len:     uint16(len(p)),
 		p_value: &p[0],
@@ -154,3 +252,101 @@ func (c *Characteristic) Write(p []byte) (n int, err error) {
 
 	return len(p), nil
 }
+
+// notify sends the value as a notification to the connected central, which
+// also updates the value. It returns false without an error when there is no
+// connected central or when it hasn't subscribed to the characteristic.
+func (c *Characteristic) notify(p []byte) (sent bool, err error) {
+	connHandle := currentConnection.Get()
+	if connHandle == C.BLE_CONN_HANDLE_INVALID {
+		return false, nil
+	}
+	errCode := C.sd_ble_gatts_hvx_noescape(connHandle,
+		c.handle,
+		C.BLE_GATT_HVX_NOTIFICATION,
+		0,
+		uint16(len(p)),
+		&p[0],
+	)
+
+	// Check for some expected errors. Don't report them as errors, the caller
+	// has to decide what to do when nothing was sent.
+	//
+	// TODO: improve CGo so that the C constant can be used.
+	switch errCode {
+	case 0:
+		gattsActivity.Set(gattsActivity.Get() + 1)
+		return true, nil
+	case 0x0008: // C.NRF_ERROR_INVALID_STATE
+		// May happen when the central has unsubscribed from the
+		// characteristic.
+		return false, nil
+	case 0x3401: // C.BLE_ERROR_GATTS_SYS_ATTR_MISSING
+		// May happen when the central is not subscribed to this
+		// characteristic.
+		return false, nil
+	}
+	return false, Error(errCode)
+}
+
+// SetIdleTimeout makes the adapter disconnect a connected central after there
+// has been no GATT server activity (writes from the central, or notifications
+// sent with Characteristic.Write) for the given duration. This frees the
+// connection for other centrals, as there can only be one connection at a
+// time in the default configuration. A zero timeout disables the idle check,
+// which is the default.
+//
+// Note that reads are handled entirely by the SoftDevice and therefore don't
+// count as activity.
+func (a *Adapter) SetIdleTimeout(timeout time.Duration) {
+	millis := timeout.Milliseconds()
+	if millis > math.MaxUint32 {
+		millis = math.MaxUint32
+	} else if millis < 1 && timeout > 0 {
+		millis = 1
+	}
+	idleTimeoutMillis.Set(uint32(millis))
+	// Goroutines are not preempted, so idleLoop can't exit between the check
+	// and the set below.
+	if millis != 0 && idleLoopRunning.Get() == 0 {
+		idleLoopRunning.Set(1)
+		go idleLoop()
+	}
+}
+
+// idleLoop disconnects idle connections, until the idle timeout is disabled.
+func idleLoop() {
+	connection := uint16(C.BLE_CONN_HANDLE_INVALID)
+	activity := gattsActivity.Get()
+	lastActive := time.Now()
+	for {
+		timeout := time.Duration(idleTimeoutMillis.Get()) * time.Millisecond
+		if timeout == 0 {
+			idleLoopRunning.Set(0)
+			return
+		}
+
+		// Check a few times per timeout period.
+		interval := timeout / 8
+		if interval < 100*time.Millisecond {
+			interval = 100 * time.Millisecond
+		}
+		time.Sleep(interval)
+
+		now := time.Now()
+		if currentConnection.Get() != connection || gattsActivity.Get() != activity {
+			connection = currentConnection.Get()
+			activity = gattsActivity.Get()
+			lastActive = now
+			continue
+		}
+		timeout = time.Duration(idleTimeoutMillis.Get()) * time.Millisecond
+		if connection != C.BLE_CONN_HANDLE_INVALID && timeout != 0 && now.Sub(lastActive) >= timeout {
+			if debug {
+				println("idle timeout, disconnecting")
+			}
+			C.sd_ble_gap_disconnect(connection, C.BLE_HCI_REMOTE_USER_TERMINATED_CONNECTION)
+			lastActive = now
+		}
+	}
+}
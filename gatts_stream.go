@@ -0,0 +1,148 @@
+//go:build softdevice || (linux && !baremetal)
+
+package bluetooth
+
+import (
+	"errors"
+	"sync"
+)
+
+// Default size of a notification sent by a Stream, which fits in the default
+// MTU.
+const defaultStreamPacketSize = 20
+
+var (
+	errStreamFull          = errors.New("bluetooth: stream buffer full, data dropped")
+	errStreamNotSubscribed = errors.New("bluetooth: no client subscribed to the stream")
+)
+
+// Stream sends a continuous stream of data, such as audio or sensor samples,
+// as notifications of a characteristic. The application writes data into a
+// bounded buffer with Write, which never blocks, and Send drains the buffer
+// one notification at a time as fast as the BLE stack accepts them.
+//
+// When the link can't keep up, the buffer fills up and new data is dropped.
+// The number of dropped bytes is available in Stats, so that the application
+// can lower its sample rate, for example.
+//
+// Write and Send may be called from different goroutines, but not from an
+// interrupt.
+type Stream struct {
+	notify func(p []byte) (sent bool, err error)
+	packet []byte
+
+	lock   sync.Mutex
+	buf    []byte // ring buffer
+	start  int    // index of the first buffered byte
+	length int    // number of buffered bytes
+	stats  StreamStats
+}
+
+// StreamStats contains statistics about a Stream.
+type StreamStats struct {
+	// Number of bytes and notifications that were sent successfully.
+	SentBytes   uint32
+	SentPackets uint32
+
+	// Number of bytes dropped because the buffer was full.
+	DroppedBytes uint32
+}
+
+// NewStream returns a new stream that sends notifications through the given
+// characteristic. The buffer holds up to bufferSize bytes, and each
+// notification contains up to packetSize bytes. A packetSize below 1 is
+// replaced by 20, which fits in the default MTU.
+func NewStream(char *Characteristic, bufferSize, packetSize int) *Stream {
+	return newStream(char.notify, bufferSize, packetSize)
+}
+
+// newStream returns a new stream that sends notifications using the given
+// function. It is separate from NewStream for testing.
+func newStream(notify func(p []byte) (sent bool, err error), bufferSize, packetSize int) *Stream {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	if packetSize < 1 {
+		packetSize = defaultStreamPacketSize
+	}
+	return &Stream{
+		notify: notify,
+		packet: make([]byte, packetSize),
+		buf:    make([]byte, bufferSize),
+	}
+}
+
+// Write adds data to the stream buffer. It never blocks: if the data doesn't
+// fit, the part that doesn't fit is dropped and an error is returned.
+func (s *Stream) Write(p []byte) (n int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n = len(s.buf) - s.length
+	if n > len(p) {
+		n = len(p)
+	}
+	end := (s.start + s.length) % len(s.buf)
+	copied := copy(s.buf[end:], p[:n])
+	copy(s.buf, p[copied:n]) // wrap around, if needed
+	s.length += n
+
+	if n < len(p) {
+		s.stats.DroppedBytes += uint32(len(p) - n)
+		return n, errStreamFull
+	}
+	return n, nil
+}
+
+// Buffered returns the number of bytes that are waiting to be sent.
+func (s *Stream) Buffered() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.length
+}
+
+// Stats returns statistics about the data sent and dropped so far.
+func (s *Stream) Stats() StreamStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats
+}
+
+// Send sends the buffered data as notifications, until the buffer is empty or
+// the BLE stack doesn't accept more data. In the latter case, the data that
+// couldn't be sent stays in the buffer and the error is returned. Data is also
+// kept, and an error is returned, while no client is subscribed to the
+// characteristic. Send should be called regularly, for example from the main
+// loop or a dedicated goroutine.
+func (s *Stream) Send() error {
+	for {
+		// Copy the next packet out of the ring buffer.
+		s.lock.Lock()
+		n := s.length
+		if n > len(s.packet) {
+			n = len(s.packet)
+		}
+		copied := copy(s.packet[:n], s.buf[s.start:])
+		copy(s.packet[copied:n], s.buf)
+		s.lock.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		sent, err := s.notify(s.packet[:n])
+		if err != nil {
+			return err
+		}
+		if !sent {
+			return errStreamNotSubscribed
+		}
+
+		// The packet was sent, remove it from the buffer.
+		s.lock.Lock()
+		s.start = (s.start + n) % len(s.buf)
+		s.length -= n
+		s.stats.SentBytes += uint32(n)
+		s.stats.SentPackets++
+		s.lock.Unlock()
+	}
+}
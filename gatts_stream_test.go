@@ -0,0 +1,105 @@
+//go:build linux && !baremetal
+
+package bluetooth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakeNotifier records the notifications sent by a Stream.
+type fakeNotifier struct {
+	packets    [][]byte
+	subscribed bool
+	err        error
+}
+
+func (f *fakeNotifier) notify(p []byte) (sent bool, err error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	if !f.subscribed {
+		return false, nil
+	}
+	f.packets = append(f.packets, append([]byte(nil), p...))
+	return true, nil
+}
+
+func TestStream(t *testing.T) {
+	notifier := &fakeNotifier{subscribed: true}
+	stream := newStream(notifier.notify, 8, 3)
+
+	// Fill the buffer, dropping what doesn't fit.
+	if n, err := stream.Write([]byte("abcde")); n != 5 || err != nil {
+		t.Fatalf("unexpected write result: %d, %v", n, err)
+	}
+	if n, err := stream.Write([]byte("fghij")); n != 3 || err != errStreamFull {
+		t.Fatalf("expected a partial write, got %d, %v", n, err)
+	}
+	if err := stream.Send(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Wrap around the end of the ring buffer.
+	stream.Write([]byte("klmno"))
+	if err := stream.Send(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expected := [][]byte{[]byte("abc"), []byte("def"), []byte("gh"), []byte("klm"), []byte("no")}
+	if len(notifier.packets) != len(expected) {
+		t.Fatalf("expected %d packets, got %q", len(expected), notifier.packets)
+	}
+	for i := range expected {
+		if !bytes.Equal(notifier.packets[i], expected[i]) {
+			t.Errorf("packet %d: expected %q, got %q", i, expected[i], notifier.packets[i])
+		}
+	}
+	stats := stream.Stats()
+	if stats != (StreamStats{SentBytes: 13, SentPackets: 5, DroppedBytes: 2}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestStreamNotSent(t *testing.T) {
+	notifier := &fakeNotifier{}
+	stream := newStream(notifier.notify, 8, 4)
+	stream.Write([]byte("abcdef"))
+
+	// Nothing may be drained or counted while no client is subscribed, or
+	// while the stack returns an error.
+	if err := stream.Send(); err != errStreamNotSubscribed {
+		t.Errorf("expected errStreamNotSubscribed, got %v", err)
+	}
+	notifier.subscribed = true
+	notifier.err = errors.New("out of buffers")
+	if err := stream.Send(); err != notifier.err {
+		t.Errorf("expected the notify error, got %v", err)
+	}
+	if stream.Buffered() != 6 || stream.Stats() != (StreamStats{}) {
+		t.Fatalf("expected data to be kept, got %d bytes buffered and stats %+v", stream.Buffered(), stream.Stats())
+	}
+
+	notifier.err = nil
+	if err := stream.Send(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if stream.Buffered() != 0 || len(notifier.packets) != 2 || !bytes.Equal(notifier.packets[1], []byte("ef")) {
+		t.Errorf("expected all data to be sent, got %q", notifier.packets)
+	}
+}
+
+func TestStreamPacketSize(t *testing.T) {
+	for _, packetSize := range []int{0, -1} {
+		notifier := &fakeNotifier{subscribed: true}
+		stream := newStream(notifier.notify, 64, packetSize)
+		stream.Write(make([]byte, 30))
+		if err := stream.Send(); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if len(notifier.packets) != 2 || len(notifier.packets[0]) != defaultStreamPacketSize {
+			t.Errorf("packet size %d: expected packets of the default size, got %d packets", packetSize, len(notifier.packets))
+		}
+	}
+}
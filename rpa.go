@@ -0,0 +1,95 @@
+package bluetooth
+
+import "crypto/aes"
+
+// IRK is an Identity Resolving Key, which is distributed during bonding. It is
+// used to generate and resolve the resolvable private addresses of a device.
+//
+// The key is stored most significant byte first, the way it is usually
+// written down (for example in the test vectors of the Bluetooth Core
+// Specification). Note that this is the reverse of how it is sent over the
+// air.
+type IRK [16]byte
+
+// IsResolvable returns whether this is a resolvable private address, which
+// can be resolved to an identity address using the IRK of the device. This
+// only makes sense for random addresses.
+func (mac MAC) IsResolvable() bool {
+	return mac[5]>>6 == 0b01
+}
+
+// Resolve returns whether the resolvable private address was generated with
+// this key, which means it belongs to the device this key was received from.
+func (irk IRK) Resolve(mac MAC) bool {
+	if !mac.IsResolvable() {
+		return false
+	}
+	// The hash in the lower 24 bits of the address is ah(IRK, prand), where
+	// prand is the upper 24 bits. See the Bluetooth Core Specification, Vol
+	// 3, Part H, section 2.2.2.
+	cipher, err := aes.NewCipher(irk[:])
+	if err != nil {
+		return false // can't happen, the key size is always valid
+	}
+	var block [16]byte
+	block[13] = mac[5]
+	block[14] = mac[4]
+	block[15] = mac[3]
+	cipher.Encrypt(block[:], block[:])
+	return block[13] == mac[2] && block[14] == mac[1] && block[15] == mac[0]
+}
+
+// IdentityResolver resolves resolvable private addresses to the identity
+// addresses of known devices. Many devices, phones in particular, advertise
+// with a private address that changes every few minutes, which makes it
+// impossible to recognize them by address alone. With the IRKs received
+// during bonding, their stable identity address can be found instead, for
+// example to filter scan results.
+//
+// Resolving is done on the host, and every known device is tried in turn, so
+// it is best to keep the number of devices small. An IdentityResolver is not
+// safe for concurrent use.
+type IdentityResolver struct {
+	identities []resolverIdentity
+}
+
+type resolverIdentity struct {
+	irk      IRK
+	identity MAC
+}
+
+// Add adds a device with the given key and identity address. If there already
+// is a device with that identity address, its key is replaced.
+func (r *IdentityResolver) Add(irk IRK, identity MAC) {
+	for i := range r.identities {
+		if r.identities[i].identity == identity {
+			r.identities[i].irk = irk
+			return
+		}
+	}
+	r.identities = append(r.identities, resolverIdentity{irk, identity})
+}
+
+// Remove removes the device with the given identity address, if present.
+func (r *IdentityResolver) Remove(identity MAC) {
+	for i := range r.identities {
+		if r.identities[i].identity == identity {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return
+		}
+	}
+}
+
+// Resolve returns the identity address of the device that the address belongs
+// to. If the address is not a resolvable private address, or it doesn't belong
+// to any known device, the address itself is returned with ok set to false.
+func (r *IdentityResolver) Resolve(mac MAC) (identity MAC, ok bool) {
+	if mac.IsResolvable() {
+		for _, entry := range r.identities {
+			if entry.irk.Resolve(mac) {
+				return entry.identity, true
+			}
+		}
+	}
+	return mac, false
+}
@@ -0,0 +1,54 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"tinygo.org/x/bluetooth/bluetoothtest"
+)
+
+func TestIRKResolve(t *testing.T) {
+	for _, tc := range bluetoothtest.AddressHashVectors {
+		// The address is prand followed by the hash, most significant byte
+		// first, which is the reverse of the MAC byte order.
+		var rpa MAC
+		for i, b := range append(tc.Prand[:], tc.Hash[:]...) {
+			rpa[5-i] = b
+		}
+		if !IRK(tc.IRK).Resolve(rpa) {
+			t.Errorf("expected %s to resolve with IRK %x", rpa, tc.IRK)
+		}
+	}
+}
+
+func TestIdentityResolver(t *testing.T) {
+	// Test vector from the Bluetooth Core Specification, Vol 3, Part H,
+	// section D.7: ah(IRK, 0x708194) = 0x0dfbaa.
+	irk := IRK(bluetoothtest.AddressHashVectors[0].IRK)
+	rpa, _ := ParseMAC("70:81:94:0D:FB:AA")
+	other, _ := ParseMAC("70:81:94:0D:FB:AB")
+	identity, _ := ParseMAC("C0:11:22:33:44:55")
+
+	if !rpa.IsResolvable() {
+		t.Fatal("expected address to be resolvable")
+	}
+	if !irk.Resolve(rpa) {
+		t.Error("expected address to resolve with the key")
+	}
+	if irk.Resolve(other) {
+		t.Error("expected other address not to resolve with the key")
+	}
+
+	var resolver IdentityResolver
+	resolver.Add(IRK{}, MAC{1})
+	resolver.Add(irk, identity)
+	if mac, ok := resolver.Resolve(rpa); !ok || mac != identity {
+		t.Errorf("expected %s to resolve to %s, got %s (ok=%v)", rpa, identity, mac, ok)
+	}
+	if mac, ok := resolver.Resolve(other); ok || mac != other {
+		t.Errorf("expected %s not to resolve, got %s (ok=%v)", other, mac, ok)
+	}
+	resolver.Remove(identity)
+	if _, ok := resolver.Resolve(rpa); ok {
+		t.Error("expected address not to resolve after removing the device")
+	}
+}
@@ -0,0 +1,111 @@
+//go:build !baremetal || (softdevice && s132v6) || (softdevice && s140v6) || (softdevice && s140v7)
+
+package bluetooth
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// Number of scan results buffered by ScanChannel.
+	scanChannelSize = 16
+
+	// How often ScanContext tries to stop a scan that hasn't started yet when
+	// the context is canceled.
+	scanContextRetryInterval = 10 * time.Millisecond
+)
+
+// ScanChannel starts a scan in the background and returns a channel on which
+// the scan results are delivered. The scan is stopped, and the channel is
+// closed, when the context is canceled or when StopScan is called.
+//
+// ScanChannel returns once the scan has started. If the scan could not be
+// started, for example because a scan is already in progress, the error is
+// returned instead.
+//
+// The channel buffers a limited number of scan results. When it is full
+// because results are not received quickly enough, new results are dropped
+// until there is space again. Unlike with Scan, the advertisement payload of
+// the results stays valid after they have been received.
+func (a *Adapter) ScanChannel(ctx context.Context) (<-chan ScanResult, error) {
+	started := make(chan struct{})
+	mask := a.stateLock.lock()
+	a.scanStarted = started
+	a.stateLock.unlock(mask)
+
+	results := make(chan ScanResult, scanChannelSize)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanErr <- a.ScanContext(ctx, func(adapter *Adapter, result ScanResult) {
+			// The payload may point to a buffer that is reused for the next
+			// scan result, so make a copy.
+			if payload, ok := result.AdvertisementPayload.(*rawAdvertisementPayload); ok {
+				payloadCopy := *payload
+				result.AdvertisementPayload = &payloadCopy
+			}
+			select {
+			case results <- result:
+			default:
+				// The channel is full, drop the result.
+			}
+		})
+		close(results)
+	}()
+
+	// Wait until the scan has started, or until ScanContext returns without
+	// starting it.
+	select {
+	case <-started:
+		return results, nil
+	case err := <-scanErr:
+		mask := a.stateLock.lock()
+		if a.scanStarted == started {
+			a.scanStarted = nil
+		}
+		a.stateLock.unlock(mask)
+		if err != nil {
+			return nil, err
+		}
+		// The context was canceled before the scan started.
+		return results, nil
+	}
+}
+
+// ScanContext is like Scan, but the scan is also stopped when the context is
+// canceled, for example because its deadline was reached. In that case, nil is
+// returned. To scan for a fixed duration, use context.WithTimeout.
+func (a *Adapter) ScanContext(ctx context.Context, callback func(*Adapter, ScanResult)) error {
+	if ctx.Err() != nil {
+		// Don't start a scan at all if the context is already canceled.
+		return nil
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		// The context may be canceled before Scan has actually started, in
+		// which case StopScan fails. Keep trying until the scan has started
+		// (and is stopped) or Scan has returned.
+		for a.StopScan() != nil {
+			select {
+			case <-done:
+				return
+			case <-time.After(scanContextRetryInterval):
+			}
+		}
+	}()
+	return a.Scan(func(adapter *Adapter, result ScanResult) {
+		if ctx.Err() != nil {
+			// The context was canceled, but the goroutine above hasn't
+			// stopped the scan yet.
+			adapter.StopScan()
+			return
+		}
+		callback(adapter, result)
+	})
+}
@@ -0,0 +1,111 @@
+//go:build !baremetal || (softdevice && s132v6) || (softdevice && s140v6) || (softdevice && s140v7)
+
+package bluetooth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var errNoDeviceFound = errors.New("bluetooth: no matching device found")
+
+// ScanFilter describes which scan results should be passed to the callback of
+// ScanWithFilter. All conditions that are set must match; the zero value
+// matches all scan results.
+type ScanFilter struct {
+	// Minimum signal strength in dBm, or 0 to accept any signal strength.
+	MinRSSI int16
+
+	// Only accept these addresses, if not empty. The addresses must be equal
+	// to the addresses in the scan results, including the random bit on
+	// platforms that have one.
+	Addresses []Address
+
+	// Only accept devices whose local name starts with this prefix, if not
+	// empty.
+	NamePrefix string
+
+	// Only accept devices that advertise at least one of these services, if
+	// not empty.
+	ServiceUUIDs []UUID
+}
+
+// Match returns whether the scan result matches the filter. The cheap checks
+// are done first, so that the advertisement payload is only parsed when
+// needed.
+func (f *ScanFilter) Match(result ScanResult) bool {
+	if f.MinRSSI != 0 && result.RSSI < f.MinRSSI {
+		return false
+	}
+	if len(f.Addresses) != 0 {
+		found := false
+		for _, address := range f.Addresses {
+			if address == result.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.NamePrefix != "" && !strings.HasPrefix(result.LocalName(), f.NamePrefix) {
+		return false
+	}
+	if len(f.ServiceUUIDs) != 0 {
+		found := false
+		for _, uuid := range f.ServiceUUIDs {
+			if result.HasServiceUUID(uuid) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanWithFilter is like Scan, but only calls the callback for scan results
+// that match the filter.
+func (a *Adapter) ScanWithFilter(filter ScanFilter, callback func(*Adapter, ScanResult)) error {
+	return a.Scan(func(adapter *Adapter, result ScanResult) {
+		if filter.Match(result) {
+			callback(adapter, result)
+		}
+	})
+}
+
+// ConnectToNearest scans for the given duration, and then connects to the
+// device matching the filter with the strongest signal, which is usually the
+// nearest device. This is useful for "hold the device close to connect" kind
+// of user interfaces.
+//
+// If no matching device was found, an error is returned.
+func (a *Adapter) ConnectToNearest(filter ScanFilter, window time.Duration, params ConnectionParams) (*Device, error) {
+	var nearest Address
+	var nearestRSSI int16
+	found := false
+	ctx, cancel := context.WithTimeout(context.Background(), window)
+	defer cancel()
+	err := a.ScanContext(ctx, func(adapter *Adapter, result ScanResult) {
+		if !filter.Match(result) {
+			return
+		}
+		if !found || result.RSSI > nearestRSSI {
+			nearest = result.Address
+			nearestRSSI = result.RSSI
+			found = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errNoDeviceFound
+	}
+	return a.Connect(nearest, params)
+}
@@ -0,0 +1,38 @@
+//go:build !darwin
+
+package bluetooth
+
+import "testing"
+
+func TestScanFilter(t *testing.T) {
+	address := Address{MACAddress{MAC: MAC{1, 2, 3, 4, 5, 6}}}
+	result := ScanResult{
+		Address: address,
+		RSSI:    -60,
+		AdvertisementPayload: &advertisementFields{AdvertisementFields{
+			LocalName:    "Sensor 12",
+			ServiceUUIDs: []UUID{ServiceUUIDHeartRate},
+		}},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter ScanFilter
+		match  bool
+	}{
+		{"empty", ScanFilter{}, true},
+		{"rssi", ScanFilter{MinRSSI: -70}, true},
+		{"weak rssi", ScanFilter{MinRSSI: -50}, false},
+		{"address", ScanFilter{Addresses: []Address{{}, address}}, true},
+		{"other address", ScanFilter{Addresses: []Address{{}}}, false},
+		{"name", ScanFilter{NamePrefix: "Sensor"}, true},
+		{"other name", ScanFilter{NamePrefix: "Light"}, false},
+		{"service", ScanFilter{ServiceUUIDs: []UUID{ServiceUUIDBattery, ServiceUUIDHeartRate}}, true},
+		{"other service", ScanFilter{ServiceUUIDs: []UUID{ServiceUUIDBattery}}, false},
+		{"all", ScanFilter{MinRSSI: -70, NamePrefix: "Sensor", ServiceUUIDs: []UUID{ServiceUUIDHeartRate}}, true},
+	} {
+		if match := tc.filter.Match(result); match != tc.match {
+			t.Errorf("%s: expected match=%v, got %v", tc.name, tc.match, match)
+		}
+	}
+}
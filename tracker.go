@@ -0,0 +1,150 @@
+package bluetooth
+
+import "time"
+
+// DeviceTracker keeps track of recently seen devices, for example to filter
+// out duplicate scan results or to detect when a device goes out of range.
+//
+// Memory usage is bounded: at most a fixed number of devices is tracked. When
+// a new device is seen while the tracker is full, the least recently seen
+// device is evicted. This makes it suitable for long-running gateways in busy
+// environments, where the number of advertisers is practically unbounded.
+//
+// A DeviceTracker is not safe for concurrent use.
+type DeviceTracker struct {
+	devices      map[Address]int // index into entries
+	entries      []trackedDevice
+	free         []int // indices of unused entries
+	head         int   // most recently seen device, or -1
+	tail         int   // least recently seen device, or -1
+	maxDevices   int
+	evictHandler func(address Address, lastSeen time.Time)
+}
+
+type trackedDevice struct {
+	address    Address
+	lastSeen   time.Time
+	prev, next int // doubly linked list ordered by lastSeen, -1 at the ends
+}
+
+// NewDeviceTracker returns a new device tracker that tracks up to maxDevices
+// devices.
+func NewDeviceTracker(maxDevices int) *DeviceTracker {
+	if maxDevices < 1 {
+		maxDevices = 1
+	}
+	return &DeviceTracker{
+		devices:    make(map[Address]int, maxDevices),
+		head:       -1,
+		tail:       -1,
+		maxDevices: maxDevices,
+	}
+}
+
+// SetEvictHandler sets a handler that is called whenever a device is removed
+// from the tracker, either because the tracker is full or because of a call
+// to Expire.
+func (t *DeviceTracker) SetEvictHandler(handler func(address Address, lastSeen time.Time)) {
+	t.evictHandler = handler
+}
+
+// Len returns the number of devices currently tracked.
+func (t *DeviceTracker) Len() int {
+	return len(t.devices)
+}
+
+// Seen marks the device as seen just now. It returns true if the device was
+// not being tracked before, which means it is either new or it has been
+// evicted or expired in the meantime.
+func (t *DeviceTracker) Seen(address Address) (isNew bool) {
+	now := time.Now()
+	if i, ok := t.devices[address]; ok {
+		t.entries[i].lastSeen = now
+		t.unlink(i)
+		t.pushFront(i)
+		return false
+	}
+
+	if len(t.devices) >= t.maxDevices {
+		t.evict(t.tail)
+	}
+
+	var i int
+	if len(t.free) != 0 {
+		i = t.free[len(t.free)-1]
+		t.free = t.free[:len(t.free)-1]
+	} else {
+		i = len(t.entries)
+		t.entries = append(t.entries, trackedDevice{})
+	}
+	t.entries[i] = trackedDevice{
+		address:  address,
+		lastSeen: now,
+	}
+	t.devices[address] = i
+	t.pushFront(i)
+	return true
+}
+
+// LastSeen returns when the device was last seen, and whether it is currently
+// being tracked at all.
+func (t *DeviceTracker) LastSeen(address Address) (lastSeen time.Time, ok bool) {
+	i, ok := t.devices[address]
+	if !ok {
+		return time.Time{}, false
+	}
+	return t.entries[i].lastSeen, true
+}
+
+// Expire removes all devices that have not been seen for at least maxAge,
+// calling the evict handler for each of them. This can be used to detect
+// devices that went out of range.
+func (t *DeviceTracker) Expire(maxAge time.Duration) {
+	now := time.Now()
+	for t.tail >= 0 && now.Sub(t.entries[t.tail].lastSeen) >= maxAge {
+		t.evict(t.tail)
+	}
+}
+
+// evict removes the entry at index i from the tracker.
+func (t *DeviceTracker) evict(i int) {
+	entry := t.entries[i]
+	t.unlink(i)
+	delete(t.devices, entry.address)
+	t.free = append(t.free, i)
+	if t.evictHandler != nil {
+		t.evictHandler(entry.address, entry.lastSeen)
+	}
+}
+
+// unlink removes the entry at index i from the linked list.
+func (t *DeviceTracker) unlink(i int) {
+	entry := &t.entries[i]
+	if entry.prev >= 0 {
+		t.entries[entry.prev].next = entry.next
+	} else {
+		t.head = entry.next
+	}
+	if entry.next >= 0 {
+		t.entries[entry.next].prev = entry.prev
+	} else {
+		t.tail = entry.prev
+	}
+	entry.prev = -1
+	entry.next = -1
+}
+
+// pushFront inserts the entry at index i at the start of the linked list (as
+// the most recently seen device).
+func (t *DeviceTracker) pushFront(i int) {
+	entry := &t.entries[i]
+	entry.prev = -1
+	entry.next = t.head
+	if t.head >= 0 {
+		t.entries[t.head].prev = i
+	}
+	t.head = i
+	if t.tail < 0 {
+		t.tail = i
+	}
+}
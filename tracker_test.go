@@ -0,0 +1,54 @@
+//go:build !darwin
+
+package bluetooth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceTracker(t *testing.T) {
+	addr := func(s string) Address {
+		var a Address
+		a.Set(s)
+		return a
+	}
+	var evicted []Address
+	tracker := NewDeviceTracker(2)
+	tracker.SetEvictHandler(func(address Address, lastSeen time.Time) {
+		evicted = append(evicted, address)
+	})
+
+	if !tracker.Seen(addr("00:00:00:00:00:01")) {
+		t.Errorf("expected first device to be new")
+	}
+	if !tracker.Seen(addr("00:00:00:00:00:02")) {
+		t.Errorf("expected second device to be new")
+	}
+	if tracker.Seen(addr("00:00:00:00:00:01")) {
+		t.Errorf("expected first device to be a duplicate")
+	}
+
+	// The tracker is full, so the least recently seen device (the second)
+	// must be evicted.
+	if !tracker.Seen(addr("00:00:00:00:00:03")) {
+		t.Errorf("expected third device to be new")
+	}
+	if len(evicted) != 1 || evicted[0] != addr("00:00:00:00:00:02") {
+		t.Errorf("expected second device to be evicted, got %v", evicted)
+	}
+	if tracker.Len() != 2 {
+		t.Errorf("expected 2 tracked devices, got %d", tracker.Len())
+	}
+	if _, ok := tracker.LastSeen(addr("00:00:00:00:00:02")); ok {
+		t.Errorf("expected second device to not be tracked anymore")
+	}
+
+	tracker.Expire(0)
+	if tracker.Len() != 0 || len(evicted) != 3 {
+		t.Errorf("expected all devices to be expired, got %d left and %d evicted", tracker.Len(), len(evicted))
+	}
+	if !tracker.Seen(addr("00:00:00:00:00:02")) {
+		t.Errorf("expected expired device to be new again")
+	}
+}
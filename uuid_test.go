@@ -9,6 +9,20 @@ func TestUUIDString(t *testing.T) {
 	checkUUID(t, New16BitUUID(0x1234), "00001234-0000-1000-8000-00805f9b34fb")
 }
 
+func TestUUID32Bit(t *testing.T) {
+	uuid := New32BitUUID(0x12345678)
+	checkUUID(t, uuid, "12345678-0000-1000-8000-00805f9b34fb")
+	if !uuid.Is32Bit() || uuid.Is16Bit() {
+		t.Errorf("expected %s to be a 32-bit UUID", uuid)
+	}
+	if uuid.Get32Bit() != 0x12345678 {
+		t.Errorf("expected 32-bit UUID 0x12345678 but got %#x", uuid.Get32Bit())
+	}
+	if New32BitUUID(0x180d) != ServiceUUIDHeartRate {
+		t.Errorf("expected 32-bit form of a 16-bit UUID to be the same UUID")
+	}
+}
+
 func checkUUID(t *testing.T, uuid UUID, check string) {
 	if uuid.String() != check {
 		t.Errorf("expected UUID %s but got %s", check, uuid.String())